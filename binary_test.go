@@ -70,3 +70,49 @@ func TestBinaryMarshal(t *testing.T) {
 		t.Fatalf("not equal")
 	}
 }
+
+func TestBinaryRealHiddenTrain(t *testing.T) {
+	for _, typ := range []UnitType{GaussianUnit, ExponentialUnit} {
+		m := New(4, 8)
+		err := m.SetHidden(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := [][]float64{
+			{0, 0, 1, 1},
+			{1, 1, 0, 0},
+		}
+		m.Train(data, &Option{
+			BatchSize: 10,
+			Iteration: 3000,
+			GibbsStep: 10,
+		})
+
+		total := 1000
+		for _, test := range []struct {
+			in   []float64
+			want []float64
+		}{
+			{
+				in:   []float64{1, 1, 0, 0},
+				want: []float64{1, 1, 0, 0},
+			},
+			{
+				in:   []float64{0, 0, 1, 1},
+				want: []float64{0, 0, 1, 1},
+			},
+		} {
+			var count int
+			for i := 0; i < total; i++ {
+				got, _ := m.Reconstruct(test.in, 2)
+				if !reflect.DeepEqual(got, test.want) {
+					count++
+				}
+			}
+			errRate := float64(count) / float64(total)
+			if errRate > 0.05 {
+				t.Fatalf("type %d: reconstruct error rate %f", typ, errRate)
+			}
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package rbm
+
+// Binomial is an rbm with binomial visible units for bounded counts like ratings or pixel intensities.
+type Binomial struct {
+	*rbm
+}
+
+// NewBinomial creates a binomial rbm whose visible units count successes out of the given trials.
+func NewBinomial(visible, hidden, trials int) *Binomial {
+	m := &Binomial{rbm: newRBM(visible, hidden)}
+	units := make([]int, visible)
+	for i := range units {
+		units[i] = i
+	}
+	m.setBinomial(units, trials)
+	return m
+}
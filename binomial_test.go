@@ -0,0 +1,58 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBinomialTrain(t *testing.T) {
+	m := NewBinomial(4, 3, 10)
+	data := [][]float64{
+		{1, 1, 9, 9},
+		{9, 9, 1, 1},
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 3000,
+		GibbsStep: 1,
+	})
+
+	total := 1000
+	for _, test := range data {
+		var sum [4]float64
+		for i := 0; i < total; i++ {
+			got, _ := m.Reconstruct(test, 1)
+			for j := range got {
+				if got[j] < 0 || got[j] > 10 {
+					t.Fatalf("expect value in [0, 10], got %f", got[j])
+				}
+				sum[j] += got[j]
+			}
+		}
+		for j := range sum {
+			mean := sum[j] / float64(total)
+			if math.Abs(mean-test[j]) > 1 {
+				t.Fatalf("expect %v, got mean %f of unit %d", test, mean, j)
+			}
+		}
+	}
+}
+
+func TestBinomialMarshal(t *testing.T) {
+	m := NewBinomial(3, 2, 255)
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewBinomial(3, 2, 255)
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+}
@@ -6,6 +6,9 @@ type Classifier struct {
 	*rbm
 
 	b      []float64
+	p      []float64 // class probability
+	rank   []int     // labels sorted by probability
+	hb     []float64 // hidden energy without label
 	input  int
 	output int
 }
@@ -16,14 +19,15 @@ func NewClassifier(input, output, hidden int) *Classifier {
 		input:  input,
 		output: output,
 		b:      make([]float64, input+output),
+		p:      make([]float64, output),
+		rank:   make([]int, output),
+		hb:     make([]float64, hidden),
 	}
-	for i := 0; i < c.Visible(); i++ {
-		if i < c.Input() {
-			c.vt[i] = binaryUnit
-		} else {
-			c.vt[i] = softmaxUnit
-		}
+	group := make([]int, output)
+	for i := 0; i < output; i++ {
+		group[i] = input + i
 	}
+	c.addSoftmax(group)
 	return c
 }
 
@@ -35,29 +39,142 @@ func (c *Classifier) Output() int {
 	return c.output
 }
 
+// Train learns the joint distribution of input and label. A negative label means the example is unlabeled,
+// so that only its input shapes the features.
 func (c *Classifier) Train(input [][]float64, output []int, opt *Option) {
-	for r := 0; r < opt.Iteration; r++ {
-		for b := 0; b < len(input); b += opt.BatchSize {
-			size := opt.BatchSize
-			if size > len(input)-b {
-				size = len(input) - b
-			}
-			c.resetDelta()
-			for i := b; i < b+size; i++ {
-				c.cd(opt.GibbsStep, c.vis(input[i], output[i]))
+	train(c, len(input), opt, func(i int) {
+		if output[i] < 0 {
+			c.unlabeledCD(opt.GibbsStep, input[i], 1)
+		} else {
+			c.cd(opt.GibbsStep, c.vis(input[i], output[i]))
+		}
+	})
+}
+
+// TrainDiscriminative maximizes log p(y|x) exactly instead of the joint likelihood of input and label
+// (Larochelle & Bengio, 2008).
+func (c *Classifier) TrainDiscriminative(input [][]float64, output []int, opt *Option) {
+	c.TrainHybrid(input, output, 0, opt)
+}
+
+// TrainHybrid maximizes log p(y|x) + alpha * log p(x, y), where the generative objective
+// acts as a data-dependent regularizer and is learned with contrastive divergence.
+// Unlabeled examples with negative label only contribute alpha * log p(x).
+func (c *Classifier) TrainHybrid(input [][]float64, output []int, alpha float64, opt *Option) {
+	train(c, len(input), opt, func(i int) {
+		if output[i] < 0 {
+			if alpha > 0 {
+				c.unlabeledCD(opt.GibbsStep, input[i], alpha)
 			}
+			return
+		}
+		c.discriminative(input[i], output[i])
+		if alpha > 0 {
+			c.weightedCD(opt.GibbsStep, c.vis(input[i], output[i]), alpha)
+		}
+	})
+}
+
+// Probabilities returns p(y|x) = softmax(-F(x, y)) over all labels.
+func (c *Classifier) Probabilities(input []float64) []float64 {
+	v := c.vis(input, -1)
+	for j := 0; j < c.Hidden(); j++ {
+		c.hb[j] = c.eh(j, v)
+	}
+	max := math.Inf(-1)
+	for y := 0; y < c.Output(); y++ {
+		f := -c.bv[c.Input()+y]
+		for j := 0; j < c.Hidden(); j++ {
+			f += c.freeEnergyHidden(j, c.hb[j]+c.w[c.Input()+y][j])
+		}
+		c.p[y] = -f
+		if c.p[y] > max {
+			max = c.p[y]
+		}
+	}
+	var sum float64
+	for y := 0; y < c.Output(); y++ {
+		c.p[y] = math.Exp(c.p[y] - max)
+		sum += c.p[y]
+	}
+	for y := 0; y < c.Output(); y++ {
+		c.p[y] /= sum
+	}
+	return c.p
+}
 
-			// To avoid having to change the learning rate when the size of a mini-batch is changed, it is helpful
-			// to divide the total gradient computed on a mini-batch by the size of the mini-batch, so when talking
-			// about learning rates we will assume that they multiply the average, per-case gradient computed on
-			// a mini-batch, not the total gradient for the mini-batch.
-			c.update(learningRate / float64(size))
+// discriminative accumulates the gradient of log p(n|input).
+func (c *Classifier) discriminative(input []float64, n int) {
+	p := c.Probabilities(input)
+	// The gradient is -∂F(x, n) + Σ p(y|x) ∂F(x, y), and the derivative of the free energy with respect
+	// to hidden activation energy is the negative expected value of the hidden unit.
+	for j := 0; j < c.Hidden(); j++ {
+		c.h[j] = 0
+	}
+	for y := 0; y < c.Output(); y++ {
+		g := -p[y]
+		if y == n {
+			g++
+		}
+		c.dbv[c.Input()+y] += g
+		for j := 0; j < c.Hidden(); j++ {
+			d := g * c.meanHidden(j, c.hb[j]+c.w[c.Input()+y][j])
+			c.dw[c.Input()+y][j] += d
+			c.dbh[j] += d
+			c.h[j] += d
+		}
+	}
+	for i := 0; i < c.Input(); i++ {
+		for j := 0; j < c.Hidden(); j++ {
+			c.dw[i][j] += c.h[j] * input[i] * c.iv[i]
 		}
 	}
 }
 
-func softplus(x float64) float64 {
-	return math.Log(1 + math.Exp(x))
+// unlabeledCD is contrastive divergence for an example without label. In the positive phase, the label is
+// marginalized with p(y|x). In the negative phase, the label is sampled freely with the input.
+func (c *Classifier) unlabeledCD(step int, input []float64, weight float64) {
+	p := c.Probabilities(input)
+	for j := 0; j < c.Hidden(); j++ {
+		c.h[j] = 0
+	}
+	for y := 0; y < c.Output(); y++ {
+		c.dbv[c.Input()+y] += weight * p[y]
+		for j := 0; j < c.Hidden(); j++ {
+			d := weight * p[y] * c.meanHidden(j, c.hb[j]+c.w[c.Input()+y][j])
+			c.dw[c.Input()+y][j] += d
+			c.h[j] += d
+		}
+	}
+	for i := 0; i < c.Input(); i++ {
+		c.dbv[i] += weight * input[i] * c.iv[i]
+		for j := 0; j < c.Hidden(); j++ {
+			c.dw[i][j] += c.h[j] * input[i] * c.iv[i]
+		}
+	}
+	for j := 0; j < c.Hidden(); j++ {
+		c.dbh[j] += c.h[j]
+	}
+
+	// Start the chain from a label drawn from p(y|x).
+	v := c.vis(input, -1)
+	for y := 0; y < c.Output(); y++ {
+		v[c.Input()+y] = p[y]
+	}
+	sampleSoftmax(v, c.sg[0])
+	rv, _ := c.Reconstruct(v, step)
+	for j := 0; j < c.Hidden(); j++ {
+		c.rh[j] = c.meanHidden(j, c.eh(j, rv))
+	}
+	for i := 0; i < c.Visible(); i++ {
+		c.dbv[i] -= weight * rv[i] * c.iv[i]
+		for j := 0; j < c.Hidden(); j++ {
+			c.dw[i][j] -= weight * c.rh[j] * rv[i] * c.iv[i]
+		}
+	}
+	for j := 0; j < c.Hidden(); j++ {
+		c.dbh[j] -= weight * c.rh[j]
+	}
 }
 
 func (c *Classifier) freeEnergy(v []float64) float64 {
@@ -66,11 +183,35 @@ func (c *Classifier) freeEnergy(v []float64) float64 {
 		e -= c.bv[i] * v[i]
 	}
 	for i := 0; i < c.Hidden(); i++ {
-		e -= softplus(c.eh(i, v))
+		e += c.freeEnergyHidden(i, c.eh(i, v))
 	}
 	return e
 }
 
+// Generate returns expected input of label after alternating gibbs sampling for the given number of steps,
+// where the label units are clamped, and the input starts from zero. It returns nil if label is out of range.
+func (c *Classifier) Generate(label, step int) []float64 {
+	if label < 0 || label >= c.Output() {
+		return nil
+	}
+	v := c.b
+	for i := 0; i < c.Input(); i++ {
+		v[i] = 0
+	}
+	c.vis(v[:c.Input()], label)
+	for s := 0; s <= step; s++ {
+		for j := 0; j < c.Hidden(); j++ {
+			c.h[j] = c.sampleHidden(j, c.eh(j, v))
+		}
+		if s == step {
+			break
+		}
+		c.resample(0, 1)
+		copy(v[:c.Input()], c.v)
+	}
+	return c.pv(c.h)[:c.Input()]
+}
+
 func (c *Classifier) vis(input []float64, n int) []float64 {
 	copy(c.b, input)
 	for i := 0; i < c.Output(); i++ {
@@ -95,3 +236,31 @@ func (c *Classifier) Classify(input []float64) int {
 	}
 	return idx
 }
+
+// TopK returns at most k labels with the highest probability in descending order.
+func (c *Classifier) TopK(input []float64, k int) []int {
+	return c.topK(c.Probabilities(input), k)
+}
+
+func (c *Classifier) topK(p []float64, k int) []int {
+	if k > c.Output() {
+		k = c.Output()
+	}
+	if k < 0 {
+		k = 0
+	}
+	for i := 0; i < c.Output(); i++ {
+		c.rank[i] = i
+	}
+	// partial selection sort
+	for i := 0; i < k; i++ {
+		max := i
+		for j := i + 1; j < c.Output(); j++ {
+			if p[c.rank[j]] > p[c.rank[max]] {
+				max = j
+			}
+		}
+		c.rank[i], c.rank[max] = c.rank[max], c.rank[i]
+	}
+	return c.rank[:k]
+}
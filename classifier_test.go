@@ -2,6 +2,8 @@ package rbm
 
 import (
 	"bytes"
+	"math"
+	"math/rand"
 	"reflect"
 	"testing"
 )
@@ -70,3 +72,257 @@ func TestClassifierMarshal(t *testing.T) {
 		t.Fatalf("not equal")
 	}
 }
+
+func TestClassifierReLUTrain(t *testing.T) {
+	c := NewClassifier(8, 3, 12)
+	err := c.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prototype, input, output := prototypes(60, 0.05)
+	c.Train(input, output, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	for label, p := range prototype {
+		got := c.Classify(p)
+		if got != label {
+			t.Fatalf("expect %v, got %v", label, got)
+		}
+	}
+}
+
+func TestClassifierDiscriminativeGradient(t *testing.T) {
+	c := NewClassifier(3, 3, 4)
+	input := []float64{1, 0, 1}
+	label := 2
+	logp := func() float64 {
+		return math.Log(c.Probabilities(input)[label])
+	}
+	c.resetDelta()
+	c.discriminative(input, label)
+
+	delta := 1e-6
+	check := func(name string, x *float64, want float64) {
+		old := *x
+		*x = old + delta
+		f1 := logp()
+		*x = old - delta
+		f2 := logp()
+		*x = old
+		got := (f1 - f2) / (2 * delta)
+		if math.Abs(got-want) > 1e-5 {
+			t.Fatalf("%s: expect gradient %f, got %f", name, want, got)
+		}
+	}
+	for i := 0; i < c.Visible(); i++ {
+		for j := 0; j < c.Hidden(); j++ {
+			check("w", &c.w[i][j], c.dw[i][j])
+		}
+	}
+	for i := c.Input(); i < c.Visible(); i++ {
+		check("bv", &c.bv[i], c.dbv[i])
+	}
+	for j := 0; j < c.Hidden(); j++ {
+		check("bh", &c.bh[j], c.dbh[j])
+	}
+}
+
+func TestClassifierDiscriminativeTrain(t *testing.T) {
+	input := [][]float64{
+		{1, 1, 0, 0},
+		{1, 1, 1, 0},
+		{0, 0, 1, 1},
+		{0, 1, 1, 1},
+		{1, 0, 1, 0},
+		{1, 0, 0, 0},
+	}
+	output := []int{
+		0,
+		0,
+		1,
+		1,
+		2,
+		2,
+	}
+	for _, alpha := range []float64{0, 0.01} {
+		c := NewClassifier(4, 3, 6)
+		c.TrainHybrid(input, output, alpha, &Option{
+			BatchSize: 10,
+			Iteration: 2000,
+			GibbsStep: 1,
+		})
+
+		for i := range input {
+			got := c.Classify(input[i])
+			if got != output[i] {
+				t.Fatalf("alpha %f: expect %v, got %v", alpha, output[i], got)
+			}
+		}
+	}
+}
+
+func TestClassifierProbabilities(t *testing.T) {
+	c := NewClassifier(4, 3, 6)
+	input := []float64{1, 0, 1, 1}
+	p := c.Probabilities(input)
+	var sum float64
+	for _, v := range p {
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("expect sum 1, got %f", sum)
+	}
+	top := c.TopK(input, 5)
+	if len(top) != 3 {
+		t.Fatalf("expect 3 labels, got %d", len(top))
+	}
+	if top[0] != c.Classify(input) {
+		t.Fatalf("expect %d, got %d", c.Classify(input), top[0])
+	}
+	p = c.Probabilities(input)
+	for i := 1; i < len(top); i++ {
+		if p[top[i-1]] < p[top[i]] {
+			t.Fatalf("not sorted: %v", top)
+		}
+	}
+	if top := c.TopK(input, -1); len(top) != 0 {
+		t.Fatalf("expect no label, got %v", top)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		c.TopK(input, 2)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestClassifierSemiSupervisedTrain(t *testing.T) {
+	patterns := [][]float64{
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 1},
+	}
+	noisy := func(label int) []float64 {
+		v := make([]float64, 6)
+		copy(v, patterns[label])
+		i := rand.Intn(len(v))
+		v[i] = 1 - v[i]
+		return v
+	}
+	var input [][]float64
+	var output []int
+	for i := 0; i < 100; i++ {
+		label := i % 2
+		input = append(input, noisy(label))
+		// Only a few examples are labeled.
+		if i < 4 {
+			output = append(output, label)
+		} else {
+			output = append(output, -1)
+		}
+	}
+	c := NewClassifier(6, 2, 6)
+	c.Train(input, output, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	var count int
+	total := 100
+	for i := 0; i < total; i++ {
+		label := i % 2
+		if c.Classify(noisy(label)) != label {
+			count++
+		}
+	}
+	errRate := float64(count) / float64(total)
+	if errRate > 0.1 {
+		t.Fatalf("classify error rate %f", errRate)
+	}
+}
+
+// prototypes returns a prototype of 8 units for each of 3 labels, and n noisy copies of them from noisyCopies.
+func prototypes(n int, noise float64) (prototype, input [][]float64, output []int) {
+	prototype = [][]float64{
+		{1, 1, 1, 0, 0, 0, 0, 0},
+		{0, 0, 1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 0, 1, 1, 1, 1},
+	}
+	input, output = noisyCopies(prototype, n, noise)
+	return
+}
+
+// noisyCopies returns n copies of the prototypes in turn with their indices as labels, where each unit is
+// flipped with probability noise.
+func noisyCopies(prototype [][]float64, n int, noise float64) (input [][]float64, output []int) {
+	for i := 0; i < n; i++ {
+		p := prototype[i%len(prototype)]
+		x := make([]float64, len(p))
+		copy(x, p)
+		for j := range x {
+			if rand.Float64() < noise {
+				x[j] = 1 - x[j]
+			}
+		}
+		input = append(input, x)
+		output = append(output, i%len(prototype))
+	}
+	return
+}
+
+// closest returns the index of the prototype with the smallest squared distance to v.
+func closest(v []float64, prototype [][]float64) int {
+	idx := -1
+	min := math.Inf(1)
+	for k, p := range prototype {
+		var dist float64
+		for i := range p {
+			dist += (v[i] - p[i]) * (v[i] - p[i])
+		}
+		if dist < min {
+			min = dist
+			idx = k
+		}
+	}
+	return idx
+}
+
+func TestClassifierGenerate(t *testing.T) {
+	c := NewClassifier(8, 3, 12)
+	prototype, input, output := prototypes(60, 0.05)
+	c.Train(input, output, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	// The average generated input of each label should be closest to its prototype.
+	for label := range prototype {
+		mean := make([]float64, 8)
+		for n := 0; n < 100; n++ {
+			v := c.Generate(label, 20)
+			for i := range mean {
+				mean[i] += v[i] / 100
+			}
+		}
+		if k := closest(mean, prototype); k != label {
+			t.Fatalf("label %d: generated input %.2f is closest to prototype %d", label, mean, k)
+		}
+	}
+
+	for _, label := range []int{-1, 3} {
+		if v := c.Generate(label, 5); v != nil {
+			t.Fatalf("label %d: expect nil, got %v", label, v)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Generate(0, 5)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
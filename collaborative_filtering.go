@@ -0,0 +1,250 @@
+package rbm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+var ErrInvalidRating = errors.New("rating item or value is out of range")
+
+// Rating is a rating from 1 to the number of rating levels that a user gives to an item.
+type Rating struct {
+	User  int
+	Item  int
+	Value int
+}
+
+// CollaborativeFiltering is an rbm for collaborative filtering (Salakhutdinov, Mnih & Hinton, 2007). Each user
+// is modeled with a K-way softmax unit for each item the user rated, and weights are shared by all users. Items
+// that are not rated are absent from the energy. The rbm is not embedded, because its dense visible units are not
+// meaningful without the ratings.
+type CollaborativeFiltering struct {
+	rbm *rbm
+
+	items   int
+	ratings int
+	user    []int            // users in training order
+	rated   map[int][]Rating // ratings of each user
+}
+
+func NewCollaborativeFiltering(items, ratings, hidden int) *CollaborativeFiltering {
+	return &CollaborativeFiltering{
+		rbm:     newRBM(items*ratings, hidden),
+		items:   items,
+		ratings: ratings,
+		rated:   make(map[int][]Rating),
+	}
+}
+
+func (m *CollaborativeFiltering) Items() int {
+	return m.items
+}
+
+func (m *CollaborativeFiltering) Ratings() int {
+	return m.ratings
+}
+
+func (m *CollaborativeFiltering) Hidden() int {
+	return m.rbm.Hidden()
+}
+
+// SetHidden changes the type of all hidden units. SoftmaxUnit is not supported.
+func (m *CollaborativeFiltering) SetHidden(t UnitType) error {
+	return m.rbm.SetHidden(t)
+}
+
+func (m *CollaborativeFiltering) Reset() {
+	m.rbm.Reset()
+}
+
+func (m *CollaborativeFiltering) resetDelta() {
+	m.rbm.resetDelta()
+}
+
+func (m *CollaborativeFiltering) update(rate float64) {
+	m.rbm.update(rate)
+}
+
+// unit returns the visible unit of rating value of item.
+func (m *CollaborativeFiltering) unit(item, value int) int {
+	return item*m.ratings + value - 1
+}
+
+// hidden unit activation energy of a user
+func (m *CollaborativeFiltering) eh(h int, rated []Rating) float64 {
+	e := m.rbm.bh[h]
+	for _, r := range rated {
+		e += m.rbm.w[m.unit(r.Item, r.Value)][h]
+	}
+	return e
+}
+
+// hidden unit activation energy of reconstructed ratings of a user
+func (m *CollaborativeFiltering) ehReconstructed(h int, rated []Rating) float64 {
+	e := m.rbm.bh[h]
+	for _, r := range rated {
+		for k := 1; k <= m.ratings; k++ {
+			i := m.unit(r.Item, k)
+			e += m.rbm.w[i][h] * m.rbm.v[i]
+		}
+	}
+	return e
+}
+
+// softmaxItem computes the distribution of ratings of item given hidden units into v.
+func (m *CollaborativeFiltering) softmaxItem(item int, h []float64) []float64 {
+	v := m.rbm.v[m.unit(item, 1) : m.unit(item, m.ratings)+1]
+	max := math.Inf(-1)
+	for k := range v {
+		v[k] = m.rbm.ev(m.unit(item, k+1), h)
+		max = math.Max(max, v[k])
+	}
+	var sum float64
+	for k := range v {
+		v[k] = math.Exp(v[k] - max)
+		sum += v[k]
+	}
+	for k := range v {
+		v[k] /= sum
+	}
+	return v
+}
+
+// Reconstruct returns reconstructed ratings and hidden units of the items a user rated with gibbs sampling.
+// The reconstructed rating of item i is one-hot at visible unit i*Ratings()+value-1; other items are not
+// updated.
+func (m *CollaborativeFiltering) Reconstruct(rated []Rating, step int) ([]float64, []float64) {
+	for s := 0; s < step; s++ {
+		for j := 0; j < m.Hidden(); j++ {
+			if s == 0 {
+				m.rbm.h[j] = m.rbm.sampleHidden(j, m.eh(j, rated))
+			} else {
+				m.rbm.h[j] = m.rbm.sampleHidden(j, m.ehReconstructed(j, rated))
+			}
+		}
+		for _, r := range rated {
+			p := m.softmaxItem(r.Item, m.rbm.h)
+			n := len(p) - 1
+			x := rand.Float64()
+			for k := range p {
+				x -= p[k]
+				if x < 0 {
+					n = k
+					break
+				}
+			}
+			for k := range p {
+				p[k] = 0
+			}
+			p[n] = 1
+		}
+	}
+	return m.rbm.v, m.rbm.h
+}
+
+// contrastive divergence for weight updates
+func (m *CollaborativeFiltering) cd(step int, rated []Rating) {
+	rv, _ := m.Reconstruct(rated, step)
+	for j := 0; j < m.Hidden(); j++ {
+		m.rbm.h[j] = m.rbm.meanHidden(j, m.eh(j, rated))
+		m.rbm.rh[j] = m.rbm.meanHidden(j, m.ehReconstructed(j, rated))
+	}
+	for _, r := range rated {
+		i := m.unit(r.Item, r.Value)
+		for j := 0; j < m.Hidden(); j++ {
+			m.rbm.dw[i][j] += m.rbm.h[j]
+		}
+		m.rbm.dbv[i]++
+		for k := 1; k <= m.ratings; k++ {
+			i := m.unit(r.Item, k)
+			if rv[i] == 0 {
+				continue
+			}
+			for j := 0; j < m.Hidden(); j++ {
+				m.rbm.dw[i][j] -= m.rbm.rh[j] * rv[i]
+			}
+			m.rbm.dbv[i] -= rv[i]
+		}
+	}
+	for j := 0; j < m.Hidden(); j++ {
+		m.rbm.dbh[j] += m.rbm.h[j] - m.rbm.rh[j]
+	}
+}
+
+// Train learns from sparse (user, item, rating) triples, where each user is a training case. The ratings are
+// kept to predict ratings of the same users.
+func (m *CollaborativeFiltering) Train(ratings []Rating, opt *Option) error {
+	err := m.SetRatings(ratings)
+	if err != nil {
+		return err
+	}
+	train(m, len(m.user), opt, func(i int) {
+		m.cd(opt.GibbsStep, m.rated[m.user[i]])
+	})
+	return nil
+}
+
+// SetRatings replaces the known ratings of all users that PredictRating uses without training.
+func (m *CollaborativeFiltering) SetRatings(ratings []Rating) error {
+	for _, r := range ratings {
+		if r.Item < 0 || r.Item >= m.items || r.Value < 1 || r.Value > m.ratings {
+			return ErrInvalidRating
+		}
+	}
+	m.rated = make(map[int][]Rating)
+	for _, r := range ratings {
+		m.rated[r.User] = append(m.rated[r.User], r)
+	}
+	m.user = m.user[:0]
+	for u := range m.rated {
+		m.user = append(m.user, u)
+	}
+	sort.Ints(m.user)
+	return nil
+}
+
+// PredictRating returns the expected rating of item by user, given the ratings of the user in training. A user
+// without any rating is predicted from the biases alone, which is the same for all such users.
+func (m *CollaborativeFiltering) PredictRating(user, item int) (float64, error) {
+	if item < 0 || item >= m.items {
+		return 0, ErrInvalidRating
+	}
+	rated := m.rated[user]
+	for j := 0; j < m.Hidden(); j++ {
+		m.rbm.h[j] = m.rbm.meanHidden(j, m.eh(j, rated))
+	}
+	var rating float64
+	for k, p := range m.softmaxItem(item, m.rbm.h) {
+		rating += float64(k+1) * p
+	}
+	return rating, nil
+}
+
+// line 1: number of items and rating levels
+//
+// line N: rbm
+//
+// Known ratings are not written, so SetRatings is needed before PredictRating after the model is read.
+func (m *CollaborativeFiltering) WriteTo(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "%d %d\n", m.items, m.ratings)
+	if err != nil {
+		return
+	}
+	return m.rbm.WriteTo(w)
+}
+
+func (m *CollaborativeFiltering) ReadFrom(r io.Reader) (err error) {
+	var items, ratings int
+	_, err = fmt.Fscan(r, &items, &ratings)
+	if err != nil {
+		return
+	}
+	if items != m.items || ratings != m.ratings {
+		return ErrInvalidArchitecture
+	}
+	return m.rbm.ReadFrom(r)
+}
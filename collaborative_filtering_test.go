@@ -0,0 +1,150 @@
+package rbm
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCollaborativeFilteringTrain(t *testing.T) {
+	// Half of the users like the first half of the items, and the others like the second half.
+	const (
+		users = 100
+		items = 10
+	)
+	likes := func(user, item int) bool {
+		return (user%2 == 0) == (item < items/2)
+	}
+	var (
+		ratings []Rating
+		heldOut []Rating
+	)
+	for u := 0; u < users; u++ {
+		perm := rand.Perm(items)
+		for _, i := range perm[:7] {
+			v := 1 + rand.Intn(2)
+			if likes(u, i) {
+				v = 4 + rand.Intn(2)
+			}
+			ratings = append(ratings, Rating{User: u, Item: i, Value: v})
+		}
+		for _, i := range perm[7:] {
+			heldOut = append(heldOut, Rating{User: u, Item: i})
+		}
+	}
+	m := NewCollaborativeFiltering(items, 5, 4)
+	err := m.Train(ratings, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wrong int
+	for _, r := range heldOut {
+		got, err := m.PredictRating(r.User, r.Item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if likes(r.User, r.Item) != (got > 3) {
+			wrong++
+		}
+	}
+	t.Logf("%d of %d predictions are wrong", wrong, len(heldOut))
+	if wrong > len(heldOut)/20 {
+		t.Fatalf("too many wrong predictions")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.cd(1, m.rated[0])
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestCollaborativeFilteringMarshal(t *testing.T) {
+	m := NewCollaborativeFiltering(4, 3, 2)
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := buf.String()
+	m2 := NewCollaborativeFiltering(4, 3, 2)
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+
+	// Training ratings are not part of the model.
+	err = m.SetRatings([]Rating{
+		{User: 3, Item: 1, Value: 2},
+		{User: 1, Item: 0, Value: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf2 := new(bytes.Buffer)
+	err = m.WriteTo(buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf2.String() != want {
+		t.Fatalf("expect %q, got %q", want, buf2.String())
+	}
+}
+
+func TestCollaborativeFilteringInvalidRating(t *testing.T) {
+	m := NewCollaborativeFiltering(4, 5, 2)
+	for _, r := range []Rating{
+		{Item: 1, Value: 0},
+		{Item: 0, Value: 0},
+		{Item: 0, Value: 6},
+		{Item: 4, Value: 1},
+		{Item: -1, Value: 1},
+	} {
+		err := m.Train([]Rating{{Item: 0, Value: 1}, r}, &Option{
+			BatchSize: 10,
+			Iteration: 1,
+			GibbsStep: 1,
+		})
+		if err != ErrInvalidRating {
+			t.Fatalf("rating %v: expect %v, got %v", r, ErrInvalidRating, err)
+		}
+	}
+	for _, item := range []int{-1, 4} {
+		_, err := m.PredictRating(0, item)
+		if err != ErrInvalidRating {
+			t.Fatalf("item %d: expect %v, got %v", item, ErrInvalidRating, err)
+		}
+	}
+	// Users without ratings are predicted from the biases alone.
+	p1, err := m.PredictRating(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := m.PredictRating(200, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p1 != p2 {
+		t.Fatalf("expect the same prediction for users without ratings, got %f and %f", p1, p2)
+	}
+}
+
+func TestCollaborativeFilteringDenseMethods(t *testing.T) {
+	// Dense methods of rbm treat the rating units as independent binary units, so they are not promoted.
+	var m interface{} = NewCollaborativeFiltering(4, 5, 2)
+	if _, ok := m.(interface {
+		Transform([]float64) []float64
+	}); ok {
+		t.Fatalf("expect no dense methods")
+	}
+}
@@ -0,0 +1,256 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// Conditional is a conditional rbm for time series (Taylor, Hinton & Roweis, 2007). The visible and hidden
+// biases of the current frame are shifted by autoregressive connections from the previous frames. The rbm is
+// not embedded, because its methods would ignore the history.
+type Conditional struct {
+	rbm *rbm
+
+	order int
+	a     [][]float64 // autoregressive weight (order * visible) * visible
+	da    [][]float64 // delta of autoregressive weight
+	b     [][]float64 // weight from history to hidden (order * visible) * hidden
+	db    [][]float64 // delta of weight from history to hidden
+}
+
+func newConditional(visible, hidden, order int) *Conditional {
+	c := &Conditional{
+		rbm:   newRBM(visible, hidden),
+		order: order,
+		a:     make([][]float64, order*visible),
+		da:    make([][]float64, order*visible),
+		b:     make([][]float64, order*visible),
+		db:    make([][]float64, order*visible),
+	}
+	for i := 0; i < order*visible; i++ {
+		c.a[i] = make([]float64, visible)
+		c.da[i] = make([]float64, visible)
+		c.b[i] = make([]float64, hidden)
+		c.db[i] = make([]float64, hidden)
+	}
+	c.Reset()
+	return c
+}
+
+// NewConditional creates a conditional rbm with binary visible units that depends on the given number
+// of previous frames.
+func NewConditional(visible, hidden, order int) *Conditional {
+	return newConditional(visible, hidden, order)
+}
+
+// NewConditionalGaussian creates a conditional rbm with gaussian visible units, which is suitable for
+// real-valued streams standardized to zero mean and unit variance.
+func NewConditionalGaussian(visible, hidden, order int) *Conditional {
+	c := newConditional(visible, hidden, order)
+	for i := 0; i < c.Visible(); i++ {
+		c.rbm.vt[i] = GaussianUnit
+	}
+	return c
+}
+
+func (c *Conditional) Order() int {
+	return c.order
+}
+
+func (c *Conditional) Visible() int {
+	return c.rbm.Visible()
+}
+
+func (c *Conditional) Hidden() int {
+	return c.rbm.Hidden()
+}
+
+// SetHidden changes the type of all hidden units. SoftmaxUnit is not supported.
+func (c *Conditional) SetHidden(t UnitType) error {
+	return c.rbm.SetHidden(t)
+}
+
+func (c *Conditional) Reset() {
+	c.rbm.Reset()
+	for i := 0; i < c.order*c.Visible(); i++ {
+		for j := 0; j < c.Visible(); j++ {
+			c.a[i][j] = weightStdDev * rand.NormFloat64()
+		}
+		for j := 0; j < c.Hidden(); j++ {
+			c.b[i][j] = weightStdDev * rand.NormFloat64()
+		}
+	}
+}
+
+func (c *Conditional) resetDelta() {
+	c.rbm.resetDelta()
+	for i := 0; i < c.order*c.Visible(); i++ {
+		for j := 0; j < c.Visible(); j++ {
+			c.da[i][j] = 0
+		}
+		for j := 0; j < c.Hidden(); j++ {
+			c.db[i][j] = 0
+		}
+	}
+}
+
+func (c *Conditional) update(rate float64) {
+	c.rbm.update(rate)
+	for i := 0; i < c.order*c.Visible(); i++ {
+		for j := 0; j < c.Visible(); j++ {
+			c.a[i][j] += rate * (c.da[i][j] - weightDecay*c.a[i][j])
+		}
+		for j := 0; j < c.Hidden(); j++ {
+			c.b[i][j] += rate * (c.db[i][j] - weightDecay*c.b[i][j])
+		}
+	}
+}
+
+// condition shifts the biases with the last order frames of history. If history is nil,
+// the biases are restored.
+func (c *Conditional) condition(history [][]float64) {
+	for i := 0; i < c.Visible(); i++ {
+		c.rbm.ov[i] = 0
+	}
+	for i := 0; i < c.Hidden(); i++ {
+		c.rbm.oh[i] = 0
+	}
+	if history == nil {
+		return
+	}
+	for k := 0; k < c.order; k++ {
+		frame := history[len(history)-1-k]
+		for d := 0; d < c.Visible(); d++ {
+			row := k*c.Visible() + d
+			for i := 0; i < c.Visible(); i++ {
+				c.rbm.ov[i] += c.a[row][i] * frame[d]
+			}
+			for i := 0; i < c.Hidden(); i++ {
+				c.rbm.oh[i] += c.b[row][i] * frame[d]
+			}
+		}
+	}
+}
+
+// contrastive divergence for frame t of a sequence
+func (c *Conditional) cd(step int, seq [][]float64, t int) {
+	history := seq[:t]
+	c.condition(history)
+	c.rbm.cd(step, seq[t])
+
+	v, rv := seq[t], c.rbm.v
+	for k := 0; k < c.order; k++ {
+		frame := history[len(history)-1-k]
+		for d := 0; d < c.Visible(); d++ {
+			row := k*c.Visible() + d
+			for i := 0; i < c.Visible(); i++ {
+				c.da[row][i] += frame[d] * (v[i] - rv[i]) * c.rbm.iv[i]
+			}
+			for i := 0; i < c.Hidden(); i++ {
+				c.db[row][i] += frame[d] * (c.rbm.h[i] - c.rbm.rh[i])
+			}
+		}
+	}
+}
+
+// Train learns from sequences of frames. Each frame that has at least Order() previous frames
+// is a training case.
+func (c *Conditional) Train(seqs [][][]float64, opt *Option) {
+	type frame struct {
+		seq int
+		t   int
+	}
+	var frames []frame
+	for i, seq := range seqs {
+		for t := c.order; t < len(seq); t++ {
+			frames = append(frames, frame{seq: i, t: t})
+		}
+	}
+	train(c, len(frames), opt, func(i int) {
+		c.cd(opt.GibbsStep, seqs[frames[i].seq], frames[i].t)
+	})
+	c.condition(nil)
+}
+
+// Reconstruct returns reconstructed visible units and hidden units of the next frame after history with
+// gibbs sampling. History must contain at least Order() frames.
+func (c *Conditional) Reconstruct(history [][]float64, v []float64, step int) ([]float64, []float64) {
+	c.condition(history)
+	rv, rh := c.rbm.Reconstruct(v, step)
+	c.condition(nil)
+	return rv, rh
+}
+
+// Generate returns n frames that follow history. Each frame is generated by alternating gibbs sampling
+// starting from the previous frame, where hidden units are sampled but expected values of visible units are
+// used to avoid sampling noise. History must contain at least Order() frames.
+func (c *Conditional) Generate(history [][]float64, n, step int) [][]float64 {
+	frames := make([][]float64, len(history), len(history)+n)
+	copy(frames, history)
+	for i := 0; i < n; i++ {
+		c.condition(frames)
+		v := frames[len(frames)-1]
+		for s := 0; s < step; s++ {
+			for j := 0; j < c.Hidden(); j++ {
+				c.rbm.h[j] = c.rbm.sampleHidden(j, c.rbm.eh(j, v))
+			}
+			v = c.rbm.pv(c.rbm.h)
+		}
+		v = c.rbm.pv(c.rbm.ph(v))
+		next := make([]float64, len(v))
+		copy(next, v)
+		frames = append(frames, next)
+	}
+	c.condition(nil)
+	return frames[len(history):]
+}
+
+// line 1: rbm
+//
+// line N: autoregressive weight separated by space
+//
+// line N: weight from history to hidden separated by space
+func (c *Conditional) WriteTo(w io.Writer) (err error) {
+	err = c.rbm.WriteTo(w)
+	if err != nil {
+		return
+	}
+	for i := 0; i < c.order*c.Visible(); i++ {
+		err = writeSlice(w, c.a[i])
+		if err != nil {
+			return
+		}
+	}
+	for i := 0; i < c.order*c.Visible(); i++ {
+		err = writeSlice(w, c.b[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *Conditional) ReadFrom(r io.Reader) (err error) {
+	err = c.rbm.ReadFrom(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < c.order*c.Visible(); i++ {
+		for j := 0; j < c.Visible(); j++ {
+			_, err = fmt.Fscan(r, &c.a[i][j])
+			if err != nil {
+				return
+			}
+		}
+	}
+	for i := 0; i < c.order*c.Visible(); i++ {
+		for j := 0; j < c.Hidden(); j++ {
+			_, err = fmt.Fscan(r, &c.b[i][j])
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
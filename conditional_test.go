@@ -0,0 +1,81 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestConditionalGaussianGenerate(t *testing.T) {
+	c := NewConditionalGaussian(2, 10, 2)
+	wave := func(t int) []float64 {
+		x := 2 * math.Pi * float64(t) / 20
+		return []float64{math.Sin(x), math.Cos(x)}
+	}
+	var seqs [][][]float64
+	for i := 0; i < 10; i++ {
+		var seq [][]float64
+		for j := 0; j < 50; j++ {
+			seq = append(seq, wave(i*7+j))
+		}
+		seqs = append(seqs, seq)
+	}
+	c.Train(seqs, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	})
+
+	// Compare with repeating the last frame of history.
+	var got, naive float64
+	for start := 0; start < 20; start += 2 {
+		history := [][]float64{wave(start), wave(start + 1)}
+		frames := c.Generate(history, 5, 10)
+		if len(frames) != 5 {
+			t.Fatalf("expect 5 frames, got %d", len(frames))
+		}
+		for i, frame := range frames {
+			want := wave(start + 2 + i)
+			for j := range frame {
+				got += math.Abs(frame[j] - want[j])
+				naive += math.Abs(history[1][j] - want[j])
+			}
+		}
+	}
+	if got >= naive {
+		t.Fatalf("expect error less than %f, got %f", naive, got)
+	}
+}
+
+func TestConditionalMarshal(t *testing.T) {
+	c := NewConditionalGaussian(3, 2, 2)
+	buf := new(bytes.Buffer)
+	err := c.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewConditionalGaussian(3, 2, 2)
+	err = c2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, c2) {
+		t.Fatalf("not equal")
+	}
+}
+
+func TestConditionalMethodsWithoutHistory(t *testing.T) {
+	// Methods of rbm ignore the history, so they are not promoted.
+	var c interface{} = NewConditional(3, 2, 2)
+	if _, ok := c.(interface {
+		Transform([]float64) []float64
+	}); ok {
+		t.Fatalf("expect no Transform")
+	}
+	if _, ok := c.(interface {
+		TrainMissing([][]float64, [][]bool, *Option)
+	}); ok {
+		t.Fatalf("expect no TrainMissing")
+	}
+}
@@ -0,0 +1,422 @@
+package rbm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+)
+
+var ErrInvalidShape = errors.New("filter or pooling size does not fit the input")
+
+// Convolutional is a convolutional rbm with probabilistic max-pooling (Lee et al., 2009). Each filter is shared
+// by all positions of a 2-D input with one or more channels, and the detection units of each filter are divided
+// into non-overlapping blocks, where at most one unit in a block is on.
+//
+// Input is flattened so that unit (c, y, x) is at (c*height+y)*width+x. Detection and pooling units are
+// flattened in the same way with one channel for each filter.
+type Convolutional struct {
+	vt       UnitType
+	channels int
+	height   int
+	width    int
+	filters  int
+	size     int
+	pool     int
+
+	w   [][]float64 // weight of each filter channels * size * size
+	dw  [][]float64
+	bv  []float64 // visible bias of each channel
+	dbv []float64
+	bh  []float64 // hidden bias of each filter
+	dbh []float64
+
+	v  []float64 // reconstructed input
+	h  []float64 // detection probability
+	rh []float64 // detection probability of reconstruction
+	hs []float64 // sampled detection units
+	p  []float64 // pooling probability
+}
+
+func newConvolutional(vt UnitType, channels, height, width, filters, size, pool int) (*Convolutional, error) {
+	if vt != BinaryUnit && vt != GaussianUnit {
+		return nil, ErrInvalidUnit
+	}
+	if channels <= 0 || filters <= 0 || size <= 0 || pool <= 0 || size > height || size > width {
+		return nil, ErrInvalidShape
+	}
+	if (height-size+1)%pool != 0 || (width-size+1)%pool != 0 {
+		return nil, ErrInvalidShape
+	}
+	m := &Convolutional{
+		vt:       vt,
+		channels: channels,
+		height:   height,
+		width:    width,
+		filters:  filters,
+		size:     size,
+		pool:     pool,
+		w:        make([][]float64, filters),
+		dw:       make([][]float64, filters),
+		bv:       make([]float64, channels),
+		dbv:      make([]float64, channels),
+		bh:       make([]float64, filters),
+		dbh:      make([]float64, filters),
+	}
+	for k := 0; k < filters; k++ {
+		m.w[k] = make([]float64, channels*size*size)
+		m.dw[k] = make([]float64, channels*size*size)
+	}
+	hidden := filters * m.detectionHeight() * m.detectionWidth()
+	m.v = make([]float64, channels*height*width)
+	m.h = make([]float64, hidden)
+	m.rh = make([]float64, hidden)
+	m.hs = make([]float64, hidden)
+	m.p = make([]float64, filters*m.OutputHeight()*m.OutputWidth())
+	m.Reset()
+	return m, nil
+}
+
+// NewConvolutional creates a convolutional rbm with binary input, where filters are size * size and
+// pooling blocks are pool * pool.
+func NewConvolutional(channels, height, width, filters, size, pool int) (*Convolutional, error) {
+	return newConvolutional(BinaryUnit, channels, height, width, filters, size, pool)
+}
+
+// NewConvolutionalGaussian creates a convolutional rbm with gaussian input, which should be standardized to zero
+// mean and unit variance.
+func NewConvolutionalGaussian(channels, height, width, filters, size, pool int) (*Convolutional, error) {
+	return newConvolutional(GaussianUnit, channels, height, width, filters, size, pool)
+}
+
+func (m *Convolutional) Reset() {
+	for k := 0; k < m.filters; k++ {
+		for i := range m.w[k] {
+			m.w[k][i] = weightStdDev * rand.NormFloat64()
+		}
+		m.bh[k] = 0
+	}
+	for c := 0; c < m.channels; c++ {
+		m.bv[c] = 0
+	}
+}
+
+func (m *Convolutional) Visible() int {
+	return len(m.v)
+}
+
+func (m *Convolutional) detectionHeight() int {
+	return m.height - m.size + 1
+}
+
+func (m *Convolutional) detectionWidth() int {
+	return m.width - m.size + 1
+}
+
+// OutputChannels returns the number of channels of pooling units, which is the number of filters.
+func (m *Convolutional) OutputChannels() int {
+	return m.filters
+}
+
+func (m *Convolutional) OutputHeight() int {
+	return m.detectionHeight() / m.pool
+}
+
+func (m *Convolutional) OutputWidth() int {
+	return m.detectionWidth() / m.pool
+}
+
+// detection unit activation energy
+func (m *Convolutional) eh(k, y, x int, v []float64) float64 {
+	e := m.bh[k]
+	for c := 0; c < m.channels; c++ {
+		for dy := 0; dy < m.size; dy++ {
+			w := m.w[k][(c*m.size+dy)*m.size:]
+			row := v[(c*m.height+y+dy)*m.width+x:]
+			for dx := 0; dx < m.size; dx++ {
+				e += w[dx] * row[dx]
+			}
+		}
+	}
+	return e
+}
+
+// visible unit activation energy
+func (m *Convolutional) ev(c, y, x int, h []float64) float64 {
+	e := m.bv[c]
+	hh, hw := m.detectionHeight(), m.detectionWidth()
+	for k := 0; k < m.filters; k++ {
+		for dy := 0; dy < m.size; dy++ {
+			hy := y - dy
+			if hy < 0 || hy >= hh {
+				continue
+			}
+			for dx := 0; dx < m.size; dx++ {
+				hx := x - dx
+				if hx < 0 || hx >= hw {
+					continue
+				}
+				e += m.w[k][(c*m.size+dy)*m.size+dx] * h[(k*hh+hy)*hw+hx]
+			}
+		}
+	}
+	return e
+}
+
+// ph computes detection probabilities of v into h and pooling probabilities into p. In each block, the
+// detection units and the state where all of them are off form a softmax.
+func (m *Convolutional) ph(v, h []float64) {
+	hh, hw := m.detectionHeight(), m.detectionWidth()
+	for k := 0; k < m.filters; k++ {
+		for y := 0; y < hh; y++ {
+			for x := 0; x < hw; x++ {
+				h[(k*hh+y)*hw+x] = m.eh(k, y, x, v)
+			}
+		}
+	}
+	for k := 0; k < m.filters; k++ {
+		for by := 0; by < m.OutputHeight(); by++ {
+			for bx := 0; bx < m.OutputWidth(); bx++ {
+				max := 0.0
+				m.block(h, k, by, bx, func(i int) {
+					max = math.Max(max, h[i])
+				})
+				off := math.Exp(-max)
+				sum := off
+				m.block(h, k, by, bx, func(i int) {
+					h[i] = math.Exp(h[i] - max)
+					sum += h[i]
+				})
+				m.block(h, k, by, bx, func(i int) {
+					h[i] /= sum
+				})
+				m.p[(k*m.OutputHeight()+by)*m.OutputWidth()+bx] = 1 - off/sum
+			}
+		}
+	}
+}
+
+// block calls f with the index of each detection unit in pooling block (by, bx) of filter k.
+func (m *Convolutional) block(h []float64, k, by, bx int, f func(i int)) {
+	hh, hw := m.detectionHeight(), m.detectionWidth()
+	for y := by * m.pool; y < (by+1)*m.pool; y++ {
+		for x := bx * m.pool; x < (bx+1)*m.pool; x++ {
+			f((k*hh+y)*hw + x)
+		}
+	}
+}
+
+// sampleHidden draws at most one detection unit in each block from probabilities h into hs.
+func (m *Convolutional) sampleHidden(h []float64) {
+	for k := 0; k < m.filters; k++ {
+		for by := 0; by < m.OutputHeight(); by++ {
+			for bx := 0; bx < m.OutputWidth(); bx++ {
+				r := rand.Float64()
+				m.block(h, k, by, bx, func(i int) {
+					r -= h[i]
+					if r < 0 {
+						m.hs[i] = 1
+						r = math.Inf(1)
+					} else {
+						m.hs[i] = 0
+					}
+				})
+			}
+		}
+	}
+}
+
+// Pool returns pooling probabilities of v, which can be the input of another convolutional rbm.
+func (m *Convolutional) Pool(v []float64) []float64 {
+	m.ph(v, m.h)
+	return m.p
+}
+
+// Reconstruct returns reconstructed input and detection units with gibbs sampling.
+func (m *Convolutional) Reconstruct(v []float64, step int) ([]float64, []float64) {
+	in := v
+	for s := 0; s < step; s++ {
+		m.ph(in, m.rh)
+		m.sampleHidden(m.rh)
+		for c := 0; c < m.channels; c++ {
+			for y := 0; y < m.height; y++ {
+				for x := 0; x < m.width; x++ {
+					e := m.ev(c, y, x, m.hs)
+					i := (c*m.height+y)*m.width + x
+					if m.vt == GaussianUnit {
+						m.v[i] = e + rand.NormFloat64()
+					} else {
+						m.v[i] = sample(sigmoid(e))
+					}
+				}
+			}
+		}
+		in = m.v
+	}
+	return m.v, m.hs
+}
+
+func (m *Convolutional) resetDelta() {
+	for k := 0; k < m.filters; k++ {
+		for i := range m.dw[k] {
+			m.dw[k][i] = 0
+		}
+		m.dbh[k] = 0
+	}
+	for c := 0; c < m.channels; c++ {
+		m.dbv[c] = 0
+	}
+}
+
+// contrastive divergence for weight updates
+func (m *Convolutional) cd(step int, v []float64) {
+	rv, _ := m.Reconstruct(v, step)
+	m.ph(v, m.h)
+	m.ph(rv, m.rh)
+
+	// Weights are shared by all positions, so the gradient is averaged over positions to keep the same
+	// learning rate for inputs of different sizes.
+	hh, hw := m.detectionHeight(), m.detectionWidth()
+	n := float64(hh * hw)
+	for k := 0; k < m.filters; k++ {
+		for y := 0; y < hh; y++ {
+			for x := 0; x < hw; x++ {
+				pos, neg := m.h[(k*hh+y)*hw+x]/n, m.rh[(k*hh+y)*hw+x]/n
+				m.dbh[k] += pos - neg
+				for c := 0; c < m.channels; c++ {
+					for dy := 0; dy < m.size; dy++ {
+						dw := m.dw[k][(c*m.size+dy)*m.size:]
+						i := (c*m.height+y+dy)*m.width + x
+						for dx := 0; dx < m.size; dx++ {
+							dw[dx] += pos*v[i+dx] - neg*rv[i+dx]
+						}
+					}
+				}
+			}
+		}
+	}
+	n = float64(m.height * m.width)
+	for c := 0; c < m.channels; c++ {
+		for i := c * m.height * m.width; i < (c+1)*m.height*m.width; i++ {
+			m.dbv[c] += (v[i] - rv[i]) / n
+		}
+	}
+}
+
+func (m *Convolutional) update(rate float64) {
+	for k := 0; k < m.filters; k++ {
+		for i := range m.w[k] {
+			m.w[k][i] += rate * (m.dw[k][i] - weightDecay*m.w[k][i])
+		}
+		m.bh[k] += rate * (m.dbh[k] - weightDecay*m.bh[k])
+	}
+	for c := 0; c < m.channels; c++ {
+		m.bv[c] += rate * (m.dbv[c] - weightDecay*m.bv[c])
+	}
+}
+
+func (m *Convolutional) Train(data [][]float64, opt *Option) {
+	train(m, len(data), opt, func(i int) {
+		m.cd(opt.GibbsStep, data[i])
+	})
+}
+
+func (m *Convolutional) shape() []int {
+	return []int{int(m.vt), m.channels, m.height, m.width, m.filters, m.size, m.pool}
+}
+
+func readConvolutionalShape(r io.Reader) (shape []int, err error) {
+	shape = make([]int, 7)
+	for i := range shape {
+		_, err = fmt.Fscan(r, &shape[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// LoadConvolutional creates a convolutional rbm from a model written by WriteTo without knowing its shape
+// beforehand.
+func LoadConvolutional(r io.Reader) (*Convolutional, error) {
+	shape, err := readConvolutionalShape(r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newConvolutional(UnitType(shape[0]), shape[1], shape[2], shape[3], shape[4], shape[5], shape[6])
+	if err != nil {
+		return nil, err
+	}
+	err = m.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Convolutional) ReadFrom(r io.Reader) (err error) {
+	shape, err := readConvolutionalShape(r)
+	if err != nil {
+		return
+	}
+	for i, n := range m.shape() {
+		if shape[i] != n {
+			return ErrInvalidArchitecture
+		}
+	}
+	return m.readBody(r)
+}
+
+func (m *Convolutional) readBody(r io.Reader) (err error) {
+	for c := range m.bv {
+		_, err = fmt.Fscan(r, &m.bv[c])
+		if err != nil {
+			return
+		}
+	}
+	for k := range m.bh {
+		_, err = fmt.Fscan(r, &m.bh[k])
+		if err != nil {
+			return
+		}
+	}
+	for k := range m.w {
+		for i := range m.w[k] {
+			_, err = fmt.Fscan(r, &m.w[k][i])
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// line 1: input unit type, channels, height, width, filters, filter size and pooling size
+//
+// line 2: visible bias of each channel separated by space
+//
+// line 3: hidden bias of each filter separated by space
+//
+// line N: weight of each filter separated by space
+func (m *Convolutional) WriteTo(w io.Writer) (err error) {
+	err = writeInts(w, m.shape())
+	if err != nil {
+		return
+	}
+	err = writeSlice(w, m.bv)
+	if err != nil {
+		return
+	}
+	err = writeSlice(w, m.bh)
+	if err != nil {
+		return
+	}
+	for k := range m.w {
+		err = writeSlice(w, m.w[k])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
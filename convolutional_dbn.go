@@ -0,0 +1,131 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+)
+
+// ConvolutionalLayer is the shape of a layer in a convolutional deep belief network.
+type ConvolutionalLayer struct {
+	Filters int
+	Size    int // filter size
+	Pool    int // pooling size
+}
+
+// ConvolutionalDBN is a convolutional deep belief network, where pooling units of each convolutional rbm are
+// the input of the next.
+type ConvolutionalDBN struct {
+	layers []*Convolutional
+}
+
+func NewConvolutionalDBN(withGaussian bool, channels, height, width int, layers ...ConvolutionalLayer) (*ConvolutionalDBN, error) {
+	if len(layers) == 0 {
+		return nil, ErrInvalidLayer
+	}
+	d := new(ConvolutionalDBN)
+	for i, l := range layers {
+		vt := BinaryUnit
+		if withGaussian && i == 0 {
+			vt = GaussianUnit
+		}
+		m, err := newConvolutional(vt, channels, height, width, l.Filters, l.Size, l.Pool)
+		if err != nil {
+			return nil, err
+		}
+		d.layers = append(d.layers, m)
+		channels, height, width = m.OutputChannels(), m.OutputHeight(), m.OutputWidth()
+	}
+	return d, nil
+}
+
+// Layer returns the convolutional rbm of layer i from the bottom.
+func (d *ConvolutionalDBN) Layer(i int) *Convolutional {
+	return d.layers[i]
+}
+
+// Train pre-trains each layer greedily from the bottom.
+func (d *ConvolutionalDBN) Train(input [][]float64, opt *Option) {
+	for _, l := range d.layers {
+		l.Train(input, opt)
+
+		input2 := make([][]float64, len(input))
+		for i, v := range input {
+			p := l.Pool(v)
+			copied := make([]float64, len(p))
+			copy(copied, p)
+			input2[i] = copied
+		}
+		input = input2
+	}
+}
+
+// Pool returns pooling probabilities of the top layer.
+func (d *ConvolutionalDBN) Pool(input []float64) []float64 {
+	for _, l := range d.layers {
+		input = l.Pool(input)
+	}
+	return input
+}
+
+// LoadConvolutionalDBN creates a convolutional deep belief network from a model written by WriteTo
+// without knowing its shape beforehand.
+func LoadConvolutionalDBN(r io.Reader) (*ConvolutionalDBN, error) {
+	var n int
+	_, err := fmt.Fscan(r, &n)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, ErrInvalidLayer
+	}
+	d := new(ConvolutionalDBN)
+	for i := 0; i < n; i++ {
+		m, err := LoadConvolutional(r)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			prev := d.layers[i-1]
+			if m.channels != prev.OutputChannels() || m.height != prev.OutputHeight() || m.width != prev.OutputWidth() {
+				return nil, ErrInvalidArchitecture
+			}
+		}
+		d.layers = append(d.layers, m)
+	}
+	return d, nil
+}
+
+func (d *ConvolutionalDBN) ReadFrom(r io.Reader) (err error) {
+	var n int
+	_, err = fmt.Fscan(r, &n)
+	if err != nil {
+		return
+	}
+	if n != len(d.layers) {
+		return ErrInvalidArchitecture
+	}
+	for _, l := range d.layers {
+		err = l.ReadFrom(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// line 1: number of layers
+//
+// line N: each layer from bottom to top
+func (d *ConvolutionalDBN) WriteTo(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "%d\n", len(d.layers))
+	if err != nil {
+		return
+	}
+	for _, l := range d.layers {
+		err = l.WriteTo(w)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package rbm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestConvolutionalDBNTrain(t *testing.T) {
+	d, err := NewConvolutionalDBN(false, 1, 12, 12,
+		ConvolutionalLayer{Filters: 4, Size: 3, Pool: 2},
+		ConvolutionalLayer{Filters: 3, Size: 2, Pool: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data [][]float64
+	for i := 0; i < 50; i++ {
+		data = append(data, bars(12, 12))
+	}
+	d.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 10,
+		GibbsStep: 1,
+	})
+	// 12 - 3 + 1 = 10, pooled to 5, 5 - 2 + 1 = 4, pooled to 2
+	if got := len(d.Pool(data[0])); got != 3*2*2 {
+		t.Fatalf("expect %d features, got %d", 3*2*2, got)
+	}
+	for _, p := range d.Pool(data[0]) {
+		if p < 0 || p > 1 {
+			t.Fatalf("expect probability, got %f", p)
+		}
+	}
+}
+
+func TestConvolutionalDBNInvalidShape(t *testing.T) {
+	_, err := NewConvolutionalDBN(false, 1, 8, 8,
+		ConvolutionalLayer{Filters: 4, Size: 3, Pool: 2},
+		ConvolutionalLayer{Filters: 3, Size: 4, Pool: 1},
+	)
+	if err != ErrInvalidShape {
+		t.Fatalf("expect %v, got %v", ErrInvalidShape, err)
+	}
+}
+
+func TestConvolutionalDBNMarshal(t *testing.T) {
+	d, err := NewConvolutionalDBN(true, 2, 9, 9,
+		ConvolutionalLayer{Filters: 3, Size: 2, Pool: 2},
+		ConvolutionalLayer{Filters: 2, Size: 3, Pool: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = d.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := LoadConvolutionalDBN(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Fatalf("not equal")
+	}
+	err = d2.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Fatalf("not equal")
+	}
+}
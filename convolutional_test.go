@@ -0,0 +1,151 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// bars returns an image with a random horizontal or vertical bar.
+func bars(height, width int) []float64 {
+	v := make([]float64, height*width)
+	if rand.Intn(2) == 0 {
+		y := rand.Intn(height)
+		for x := 0; x < width; x++ {
+			v[y*width+x] = 1
+		}
+	} else {
+		x := rand.Intn(width)
+		for y := 0; y < height; y++ {
+			v[y*width+x] = 1
+		}
+	}
+	return v
+}
+
+func TestConvolutionalPooling(t *testing.T) {
+	m, err := NewConvolutional(2, 6, 8, 3, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range m.w {
+		for i := range m.w[k] {
+			m.w[k][i] = rand.NormFloat64()
+		}
+	}
+	v := make([]float64, m.Visible())
+	for i := range v {
+		v[i] = float64(rand.Intn(2))
+	}
+	p := m.Pool(v)
+	m.sampleHidden(m.h)
+	for k := 0; k < m.OutputChannels(); k++ {
+		for by := 0; by < m.OutputHeight(); by++ {
+			for bx := 0; bx < m.OutputWidth(); bx++ {
+				var sum, on float64
+				m.block(m.h, k, by, bx, func(i int) {
+					sum += m.h[i]
+					on += m.hs[i]
+				})
+				want := p[(k*m.OutputHeight()+by)*m.OutputWidth()+bx]
+				if math.Abs(sum-want) > 1e-9 {
+					t.Fatalf("expect pooling probability %f, got %f", want, sum)
+				}
+				if on > 1 {
+					t.Fatalf("expect at most one unit on, got %f", on)
+				}
+			}
+		}
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		m.cd(1, v)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestConvolutionalTrain(t *testing.T) {
+	m, err := NewConvolutional(1, 8, 8, 4, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data [][]float64
+	for i := 0; i < 100; i++ {
+		data = append(data, bars(8, 8))
+	}
+	loss := func() float64 {
+		var sum float64
+		for _, v := range data {
+			rv, _ := m.Reconstruct(v, 1)
+			for i := range v {
+				sum += math.Abs(v[i] - rv[i])
+			}
+		}
+		return sum / float64(len(data))
+	}
+	before := loss()
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 50,
+		GibbsStep: 1,
+	})
+	after := loss()
+	t.Logf("reconstruction error before %f, after %f", before, after)
+	if after > before/2 {
+		t.Fatalf("reconstruction error is not reduced enough")
+	}
+}
+
+func TestConvolutionalMarshal(t *testing.T) {
+	m, err := NewConvolutionalGaussian(3, 7, 7, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := LoadConvolutional(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+	m3, err := NewConvolutionalGaussian(3, 7, 7, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m3) {
+		t.Fatalf("not equal")
+	}
+	m4, err := NewConvolutional(3, 7, 7, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m4.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
+
+func TestConvolutionalInvalidShape(t *testing.T) {
+	for _, shape := range [][]int{
+		{1, 4, 4, 2, 5, 1},
+		{1, 8, 8, 2, 3, 4},
+		{0, 8, 8, 2, 3, 2},
+	} {
+		_, err := NewConvolutional(shape[0], shape[1], shape[2], shape[3], shape[4], shape[5])
+		if err != ErrInvalidShape {
+			t.Fatalf("%v: expect %v, got %v", shape, ErrInvalidShape, err)
+		}
+	}
+}
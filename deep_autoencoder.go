@@ -0,0 +1,196 @@
+package rbm
+
+import (
+	"io"
+)
+
+// DeepAutoencoder learns low-dimensional codes (Hinton & Salakhutdinov, 2006). A stack of rbms is
+// pre-trained greedily, and then unrolled into an encoder and a decoder, which are fine-tuned with
+// backpropagation. Code units are linear.
+type DeepAutoencoder struct {
+	stack
+
+	decoder []*rbm // decoder of each layer from bottom to top, where visible units are the code
+}
+
+// NewDeepAutoencoder creates a deep autoencoder where units are the unit count of each layer from the input
+// to the code.
+func NewDeepAutoencoder(withGaussian bool, units ...int) (*DeepAutoencoder, error) {
+	if len(units) < 2 {
+		return nil, ErrInvalidLayer
+	}
+	a := &DeepAutoencoder{
+		stack: newStack(withGaussian, units),
+	}
+	for _, l := range a.layers() {
+		a.decoder = append(a.decoder, newRBM(l.Hidden(), l.Visible()))
+	}
+	// The code layer has linear units instead of binary units, so that codes can use the whole range of
+	// real values.
+	a.layers()[len(a.layers())-1].SetHidden(GaussianUnit)
+	if withGaussian {
+		a.decoder[0].SetHidden(GaussianUnit)
+	}
+	return a, nil
+}
+
+func (a *DeepAutoencoder) units() []int {
+	layers := a.layers()
+	return append(a.stack.units(), layers[len(layers)-1].Hidden())
+}
+
+// Train pre-trains each layer greedily from the bottom, and unrolls the layers, where the decoder starts with
+// the transposed weights of the encoder. The weights are no longer tied after unrolling.
+func (a *DeepAutoencoder) Train(input [][]float64, opt *Option) {
+	a.pretrain(input, opt)
+	for k, l := range a.layers() {
+		d := a.decoder[k]
+		for i := 0; i < l.Visible(); i++ {
+			for j := 0; j < l.Hidden(); j++ {
+				d.w[j][i] = l.w[i][j]
+			}
+			d.bh[i] = l.bv[i]
+		}
+	}
+}
+
+func (a *DeepAutoencoder) resetDelta() {
+	for k, l := range a.layers() {
+		l.resetDelta()
+		a.decoder[k].resetDelta()
+	}
+}
+
+func (a *DeepAutoencoder) update(rate float64) {
+	for k, l := range a.layers() {
+		l.update(rate)
+		a.decoder[k].update(rate)
+	}
+}
+
+// backprop accumulates the gradient of the negative reconstruction error, which is squared error for
+// gaussian input and cross-entropy for binary input.
+func (a *DeepAutoencoder) backprop(input []float64) {
+	layers := a.layers()
+	out := a.Reconstruct(input)
+
+	// The output of each layer is in h, and the gradient with respect to it is kept in rh.
+	// With both errors, the gradient with respect to the activation energy of the output is the difference.
+	bottom := a.decoder[0]
+	for i := range out {
+		bottom.rh[i] = input[i] - out[i]
+	}
+	for k := range a.decoder {
+		d := a.decoder[k]
+		v, g := layers[k].h, layers[k].rh
+		if k < len(a.decoder)-1 {
+			v, g = a.decoder[k+1].h, a.decoder[k+1].rh
+		}
+		if k > 0 {
+			derivative(d, v)
+		}
+		backward(d, v, g)
+	}
+	for k := len(layers) - 1; k >= 0; k-- {
+		if k > 0 {
+			derivative(layers[k], layers[k-1].h)
+			backward(layers[k], layers[k-1].h, layers[k-1].rh)
+		} else {
+			derivative(layers[k], input)
+			backward(layers[k], input, nil)
+		}
+	}
+}
+
+// FineTune trains the unrolled encoder and decoder with backpropagation to minimize reconstruction error.
+func (a *DeepAutoencoder) FineTune(input [][]float64, opt *Option) {
+	train(a, len(input), opt, func(i int) {
+		a.backprop(input[i])
+	})
+}
+
+// Encode returns the code of input.
+func (a *DeepAutoencoder) Encode(input []float64) []float64 {
+	return a.features(input)
+}
+
+// Decode returns the input reconstructed from code.
+func (a *DeepAutoencoder) Decode(code []float64) []float64 {
+	for k := len(a.decoder) - 1; k >= 0; k-- {
+		code = a.decoder[k].ph(code)
+	}
+	return code
+}
+
+// Reconstruct encodes and then decodes input.
+func (a *DeepAutoencoder) Reconstruct(input []float64) []float64 {
+	return a.Decode(a.Encode(input))
+}
+
+// LoadDeepAutoencoder creates a deep autoencoder from a model written by WriteTo
+// without knowing its architecture beforehand.
+func LoadDeepAutoencoder(r io.Reader) (*DeepAutoencoder, error) {
+	withGaussian, units, err := readArchitecture(r, 2)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewDeepAutoencoder(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	err = a.readLayers(r)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *DeepAutoencoder) ReadFrom(r io.Reader) (err error) {
+	withGaussian, units, err := readArchitecture(r, 2)
+	if err != nil {
+		return
+	}
+	if !a.sameArchitecture(withGaussian, units, a.units()) {
+		return ErrInvalidArchitecture
+	}
+	return a.readLayers(r)
+}
+
+func (a *DeepAutoencoder) readLayers(r io.Reader) (err error) {
+	err = a.stack.readLayers(r)
+	if err != nil {
+		return
+	}
+	for _, d := range a.decoder {
+		err = d.ReadFrom(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// line 1: whether the bottom layer is gaussian, and the number of layer units
+//
+// line 2: unit count of each layer separated by space
+//
+// line N: each encoder layer from bottom to top
+//
+// line N: each decoder layer from bottom to top
+func (a *DeepAutoencoder) WriteTo(w io.Writer) (err error) {
+	err = a.writeHeader(w, a.units())
+	if err != nil {
+		return
+	}
+	err = a.writeLayers(w)
+	if err != nil {
+		return
+	}
+	for _, d := range a.decoder {
+		err = d.WriteTo(w)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
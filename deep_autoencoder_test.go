@@ -0,0 +1,152 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// reconstruction error as minimized by fine-tuning
+func autoencoderError(a *DeepAutoencoder, input []float64) float64 {
+	out := a.Reconstruct(input)
+	var e float64
+	for i := range input {
+		if a.gaussian != nil {
+			e += (input[i] - out[i]) * (input[i] - out[i]) / 2
+		} else {
+			e -= input[i]*math.Log(out[i]) + (1-input[i])*math.Log(1-out[i])
+		}
+	}
+	return e
+}
+
+func TestDeepAutoencoderGradient(t *testing.T) {
+	for _, withGaussian := range []bool{false, true} {
+		a, err := NewDeepAutoencoder(withGaussian, 4, 5, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := []float64{1, 0, 0, 1}
+		a.resetDelta()
+		a.backprop(input)
+
+		delta := 1e-6
+		check := func(name string, x *float64, want float64) {
+			old := *x
+			*x = old + delta
+			f1 := autoencoderError(a, input)
+			*x = old - delta
+			f2 := autoencoderError(a, input)
+			*x = old
+			got := -(f1 - f2) / (2 * delta)
+			if math.Abs(got-want) > 1e-5 {
+				t.Fatalf("%s: expect gradient %f, got %f", name, want, got)
+			}
+		}
+		for k, l := range a.layers() {
+			for _, m := range []*rbm{l, a.decoder[k]} {
+				for i := 0; i < m.Visible(); i++ {
+					for j := 0; j < m.Hidden(); j++ {
+						check("w", &m.w[i][j], m.dw[i][j])
+					}
+				}
+				for j := 0; j < m.Hidden(); j++ {
+					check("bh", &m.bh[j], m.dbh[j])
+				}
+			}
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			a.backprop(input)
+		})
+		if allocs != 0 {
+			t.Fatalf("expect no allocation, got %f", allocs)
+		}
+	}
+}
+
+func TestDeepAutoencoderTrain(t *testing.T) {
+	a, err := NewDeepAutoencoder(false, 12, 16, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// noisy copies of a few prototypes
+	prototype := [][]float64{
+		{1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 1, 1, 1, 1, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1},
+		{1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0},
+	}
+	input, _ := noisyCopies(prototype, 100, 0.05)
+	loss := func() float64 {
+		var sum float64
+		for _, x := range prototype {
+			sum += autoencoderError(a, x)
+		}
+		return sum / float64(len(prototype))
+	}
+	opt := &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	}
+	a.Train(input, opt)
+	before := loss()
+	opt.Iteration = 500
+	a.FineTune(input, opt)
+	after := loss()
+	t.Logf("reconstruction error before %f, after %f", before, after)
+	if after >= before {
+		t.Fatalf("fine-tuning does not reduce reconstruction error")
+	}
+	for _, x := range prototype {
+		out := a.Reconstruct(x)
+		for i := range x {
+			if math.Abs(out[i]-x[i]) > 0.5 {
+				t.Fatalf("%v: got %v", x, out)
+			}
+		}
+	}
+	if got := len(a.Encode(prototype[0])); got != 2 {
+		t.Fatalf("expect code of length 2, got %d", got)
+	}
+}
+
+func TestDeepAutoencoderMarshal(t *testing.T) {
+	a, err := NewDeepAutoencoder(true, 4, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = a.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := LoadDeepAutoencoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, a2) {
+		t.Fatalf("not equal")
+	}
+	a3, err := NewDeepAutoencoder(true, 4, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, a3) {
+		t.Fatalf("not equal")
+	}
+	a4, err := NewDeepAutoencoder(true, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a4.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
@@ -0,0 +1,239 @@
+package rbm
+
+import (
+	"io"
+)
+
+// DeepBeliefNetwork is a generative model (Hinton, Osindero & Teh, 2006). The top classifier is an undirected
+// associative memory, and the lower layers are directed with separate recognition and generative weights.
+type DeepBeliefNetwork struct {
+	*StackedClassifier
+
+	generative []*rbm // generative weights of each lower layer from bottom to top
+}
+
+// NewDeepBeliefNetwork creates a deep belief network with the same units as NewStackedClassifier.
+func NewDeepBeliefNetwork(withGaussian bool, units ...int) (*DeepBeliefNetwork, error) {
+	s, err := NewStackedClassifier(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	d := &DeepBeliefNetwork{
+		StackedClassifier: s,
+	}
+	for _, l := range s.layers() {
+		g := newRBM(l.Visible(), l.Hidden())
+		copy(g.vt, l.vt)
+		d.generative = append(d.generative, g)
+	}
+	return d, nil
+}
+
+// Train pre-trains each layer greedily from the bottom, and unties recognition and generative weights.
+func (d *DeepBeliefNetwork) Train(input [][]float64, output []int, opt *Option) {
+	d.StackedClassifier.Train(input, output, opt)
+	for k, l := range d.layers() {
+		g := d.generative[k]
+		for i := 0; i < l.Visible(); i++ {
+			copy(g.w[i], l.w[i])
+		}
+		copy(g.bv, l.bv)
+	}
+}
+
+func (d *DeepBeliefNetwork) resetDelta() {
+	d.StackedClassifier.resetDelta()
+	for _, g := range d.generative {
+		g.resetDelta()
+	}
+}
+
+// update applies the gradient of the up-down algorithm, where recognition weights have no visible biases, and
+// the associative memory learns all of its parameters.
+func (d *DeepBeliefNetwork) update(rate float64) {
+	for _, l := range d.layers() {
+		l.updateWeights(rate)
+	}
+	d.classifier.update(rate)
+	for _, g := range d.generative {
+		g.update(rate)
+	}
+}
+
+// sampleBinary replaces probabilities of binary visible units with binary states.
+func sampleBinary(m *rbm, v []float64) {
+	for i := range v {
+		if m.vt[i] == BinaryUnit {
+			v[i] = sample(v[i])
+		}
+	}
+}
+
+// upDown accumulates the gradient of the up-down algorithm for an example with label n.
+func (d *DeepBeliefNetwork) upDown(step int, input []float64, n int) {
+	layers := d.layers()
+	c := d.classifier
+
+	// Wake phase: states are sampled bottom-up with recognition weights, and generative weights learn to
+	// reconstruct each state from the one above.
+	v := input
+	for _, l := range layers {
+		h := l.ph(v)
+		for j := range h {
+			h[j] = sample(h[j])
+		}
+		v = h
+	}
+	for k, g := range d.generative {
+		below := input
+		if k > 0 {
+			below = layers[k-1].h
+		}
+		above := layers[k].h
+		p := g.pv(above)
+		for i := 0; i < g.Visible(); i++ {
+			e := (below[i] - p[i]) * g.iv[i]
+			g.dbv[i] += e
+			for j := 0; j < g.Hidden(); j++ {
+				g.dw[i][j] += e * above[j]
+			}
+		}
+	}
+
+	// The associative memory learns with contrastive divergence from the top wake state.
+	if n < 0 {
+		c.unlabeledCD(step, v, 1)
+	} else {
+		c.cd(step, c.vis(v, n))
+	}
+
+	// Sleep phase: states are sampled top-down with generative weights from the associative memory, and
+	// recognition weights learn to infer each state from the one below.
+	v = c.v[:c.Input()]
+	for k := len(layers) - 1; k >= 0; k-- {
+		g := d.generative[k]
+		below := g.pv(v)
+		sampleBinary(g, below)
+		l := layers[k]
+		p := l.ph(below)
+		for j := 0; j < l.Hidden(); j++ {
+			e := v[j] - p[j]
+			l.dbh[j] += e
+			for i := 0; i < l.Visible(); i++ {
+				l.dw[i][j] += e * below[i] * l.iv[i]
+			}
+		}
+		v = below
+	}
+}
+
+// FineTune trains recognition weights, generative weights and the associative memory with the up-down
+// algorithm. A negative label means the example is unlabeled.
+func (d *DeepBeliefNetwork) FineTune(input [][]float64, output []int, opt *Option) {
+	train(d, len(input), opt, func(i int) {
+		d.upDown(opt.GibbsStep, input[i], output[i])
+	})
+}
+
+// Generate returns expected input after alternating gibbs sampling in the associative memory for the given
+// number of steps, followed by a top-down pass with generative weights. If label is negative, the label is
+// sampled freely; otherwise it is clamped. It returns nil if label is not less than the number of labels.
+func (d *DeepBeliefNetwork) Generate(label, step int) []float64 {
+	c := d.classifier
+	if label >= c.Output() {
+		return nil
+	}
+	v := c.b
+	for i := 0; i < c.Input(); i++ {
+		v[i] = 0
+	}
+	c.vis(v[:c.Input()], label)
+	if label < 0 {
+		for y := 0; y < c.Output(); y++ {
+			v[c.Input()+y] = 1 / float64(c.Output())
+		}
+		sampleSoftmax(v, c.sg[0])
+	}
+	for s := 0; s < step; s++ {
+		for j := 0; j < c.Hidden(); j++ {
+			c.h[j] = c.sampleHidden(j, c.eh(j, v))
+		}
+		p := c.pv(c.h)
+		for i := 0; i < c.Input(); i++ {
+			v[i] = sample(p[i])
+		}
+		if label < 0 {
+			copy(v[c.Input():], p[c.Input():])
+			sampleSoftmax(v, c.sg[0])
+		}
+	}
+
+	v = v[:c.Input()]
+	for k := len(d.generative) - 1; k >= 0; k-- {
+		v = d.generative[k].pv(v)
+		if k > 0 {
+			sampleBinary(d.generative[k], v)
+		}
+	}
+	return v
+}
+
+// LoadDeepBeliefNetwork creates a deep belief network from a model written by WriteTo
+// without knowing its architecture beforehand.
+func LoadDeepBeliefNetwork(r io.Reader) (*DeepBeliefNetwork, error) {
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDeepBeliefNetwork(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	err = d.readLayers(r)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DeepBeliefNetwork) ReadFrom(r io.Reader) (err error) {
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return
+	}
+	if !d.sameArchitecture(withGaussian, units, d.units()) {
+		return ErrInvalidArchitecture
+	}
+	return d.readLayers(r)
+}
+
+func (d *DeepBeliefNetwork) readLayers(r io.Reader) (err error) {
+	err = d.StackedClassifier.readLayers(r)
+	if err != nil {
+		return
+	}
+	for _, g := range d.generative {
+		err = g.ReadFrom(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// line 1: stacked classifier
+//
+// line N: generative weights of each lower layer from bottom to top
+func (d *DeepBeliefNetwork) WriteTo(w io.Writer) (err error) {
+	err = d.StackedClassifier.WriteTo(w)
+	if err != nil {
+		return
+	}
+	for _, g := range d.generative {
+		err = g.WriteTo(w)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
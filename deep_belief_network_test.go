@@ -0,0 +1,86 @@
+package rbm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDeepBeliefNetworkGenerate(t *testing.T) {
+	d, err := NewDeepBeliefNetwork(false, 8, 12, 12, 3, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prototype, input, output := prototypes(60, 0.05)
+	opt := &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	}
+	d.Train(input, output, opt)
+	d.FineTune(input, output, opt)
+
+	// The average generated input of each label should be closest to its prototype.
+	for label := range prototype {
+		mean := make([]float64, 8)
+		for n := 0; n < 100; n++ {
+			v := d.Generate(label, 20)
+			for i := range mean {
+				mean[i] += v[i] / 100
+			}
+		}
+		t.Logf("label %d: %.2f", label, mean)
+		if k := closest(mean, prototype); k != label {
+			t.Fatalf("label %d: generated input is closest to prototype %d", label, k)
+		}
+	}
+
+	if v := d.Generate(3, 5); v != nil {
+		t.Fatalf("expect nil, got %v", v)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		d.Generate(-1, 5)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestDeepBeliefNetworkMarshal(t *testing.T) {
+	d, err := NewDeepBeliefNetwork(true, 4, 3, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = d.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := LoadDeepBeliefNetwork(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Fatalf("not equal")
+	}
+	d3, err := NewDeepBeliefNetwork(true, 4, 3, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d3) {
+		t.Fatalf("not equal")
+	}
+	d4, err := NewDeepBeliefNetwork(false, 4, 3, 2, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d4.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
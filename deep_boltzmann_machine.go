@@ -0,0 +1,302 @@
+package rbm
+
+import (
+	"io"
+	"math/rand"
+)
+
+// Number of mean-field updates in the positive phase.
+const meanFieldStep = 10
+
+// DeepBoltzmannMachine has multiple hidden layers with undirected connections (Salakhutdinov & Hinton, 2009).
+// Each pair of adjacent layers is connected by the weights of an rbm, where the visible biases of the bottom
+// rbm are the biases of the input, and the hidden biases of each rbm are the biases of the layer above it.
+type DeepBoltzmannMachine struct {
+	stack
+
+	mu    [][]float64   // mean-field posterior of each layer
+	chain [][][]float64 // state of each layer in each persistent markov chain
+	x     [][]float64   // state of each layer for Generate
+}
+
+// NewDeepBoltzmannMachine creates a deep boltzmann machine where units are the unit count of each layer from
+// the input to the top hidden layer.
+func NewDeepBoltzmannMachine(withGaussian bool, units ...int) (*DeepBoltzmannMachine, error) {
+	if len(units) < 2 {
+		return nil, ErrInvalidLayer
+	}
+	return &DeepBoltzmannMachine{
+		stack: newStack(withGaussian, units),
+		mu:    newState(units),
+		x:     newState(units),
+	}, nil
+}
+
+func newState(units []int) [][]float64 {
+	x := make([][]float64, len(units))
+	for k, n := range units {
+		x[k] = make([]float64, n)
+	}
+	return x
+}
+
+func (d *DeepBoltzmannMachine) units() []int {
+	layers := d.layers()
+	return append(d.stack.units(), layers[len(layers)-1].Hidden())
+}
+
+// upward returns the activation energy of hidden unit j of m when visible input is multiplied by scale.
+func upward(m *rbm, j int, v []float64, scale float64) float64 {
+	var e float64
+	for i := 0; i < m.Visible(); i++ {
+		e += m.w[i][j] * v[i] * m.iv[i]
+	}
+	return m.bh[j] + scale*e
+}
+
+// downward returns the activation energy of visible unit i of m when hidden input is multiplied by scale.
+func downward(m *rbm, i int, h []float64, scale float64) float64 {
+	var e float64
+	for j := 0; j < m.Hidden(); j++ {
+		e += m.w[i][j] * h[j]
+	}
+	return m.bv[i] + scale*e
+}
+
+// sampleVisible draws visible unit i of m given its activation energy.
+func sampleVisible(m *rbm, i int, e float64) float64 {
+	if m.vt[i] == GaussianUnit {
+		return e + rand.NormFloat64()
+	}
+	return sample(sigmoid(e))
+}
+
+// scaledCD is contrastive divergence for an rbm where bottom-up input is multiplied by up, and top-down input
+// is multiplied by down. With a factor of 2, it is the same as an rbm with two copies of the layer that share
+// weights.
+func scaledCD(m *rbm, step int, v []float64, up, down float64) {
+	x := v
+	for s := 0; s < step; s++ {
+		for j := 0; j < m.Hidden(); j++ {
+			m.rh[j] = sample(sigmoid(upward(m, j, x, up)))
+		}
+		for i := 0; i < m.Visible(); i++ {
+			m.v[i] = sampleVisible(m, i, downward(m, i, m.rh, down))
+		}
+		x = m.v
+	}
+	for j := 0; j < m.Hidden(); j++ {
+		m.h[j] = sigmoid(upward(m, j, v, up))
+		m.rh[j] = sigmoid(upward(m, j, m.v, up))
+	}
+	m.updateDelta(v, m.v, m.h, m.rh, 1)
+}
+
+// Train pre-trains each layer greedily from the bottom. To compensate for the missing input from the layer above
+// or below, the bottom rbm doubles its input, the top rbm doubles its top-down input, and the weights of the
+// rbms in between are halved afterwards.
+func (d *DeepBoltzmannMachine) Train(input [][]float64, opt *Option) {
+	layers := d.layers()
+	for k, l := range layers {
+		up, down := 1.0, 1.0
+		if len(layers) > 1 {
+			if k == 0 {
+				up = 2
+			}
+			if k == len(layers)-1 {
+				down = 2
+			}
+		}
+		train(l, len(input), opt, func(i int) {
+			scaledCD(l, opt.GibbsStep, input[i], up, down)
+		})
+
+		input2 := make([][]float64, len(input))
+		for i, v := range input {
+			h := make([]float64, l.Hidden())
+			for j := range h {
+				h[j] = sigmoid(upward(l, j, v, up))
+			}
+			input2[i] = h
+		}
+		input = input2
+	}
+	for k, l := range layers {
+		if k > 0 {
+			for i := range l.bv {
+				l.bv[i] = 0
+			}
+		}
+		if k > 0 && k < len(layers)-1 {
+			for i := range l.w {
+				for j := range l.w[i] {
+					l.w[i][j] /= 2
+				}
+			}
+		}
+	}
+}
+
+// energy returns the activation energy of unit j in layer k given the layers below and above.
+func (d *DeepBoltzmannMachine) energy(k, j int, x [][]float64) float64 {
+	layers := d.layers()
+	if k == 0 {
+		return downward(layers[0], j, x[1], 1)
+	}
+	e := upward(layers[k-1], j, x[k-1], 1)
+	if k < len(layers) {
+		l := layers[k]
+		for m := 0; m < l.Hidden(); m++ {
+			e += l.w[j][m] * x[k+1][m]
+		}
+	}
+	return e
+}
+
+// MeanField returns the approximate posterior of each hidden layer given input, where the first layer is input.
+func (d *DeepBoltzmannMachine) MeanField(input []float64) [][]float64 {
+	mu := d.mu
+	copy(mu[0], input)
+	// Start from a bottom-up pass with the layers above turned off.
+	for k := 1; k < len(mu); k++ {
+		for j := range mu[k] {
+			mu[k][j] = sigmoid(upward(d.layers()[k-1], j, mu[k-1], 1))
+		}
+	}
+	for s := 0; s < meanFieldStep; s++ {
+		for k := 1; k < len(mu); k++ {
+			for j := range mu[k] {
+				mu[k][j] = sigmoid(d.energy(k, j, mu))
+			}
+		}
+	}
+	return mu
+}
+
+// gibbs updates the odd layers and then the even layers of state x for the given number of steps.
+func (d *DeepBoltzmannMachine) gibbs(x [][]float64, step int) {
+	for s := 0; s < step; s++ {
+		for _, parity := range []int{1, 0} {
+			for k := parity; k < len(x); k += 2 {
+				for j := range x[k] {
+					e := d.energy(k, j, x)
+					if k == 0 {
+						x[k][j] = sampleVisible(d.layers()[0], j, e)
+					} else {
+						x[k][j] = sample(sigmoid(e))
+					}
+				}
+			}
+		}
+	}
+}
+
+func (d *DeepBoltzmannMachine) resetDelta() {
+	for _, l := range d.layers() {
+		l.resetDelta()
+	}
+}
+
+func (d *DeepBoltzmannMachine) update(rate float64) {
+	for _, l := range d.layers() {
+		l.update(rate)
+	}
+}
+
+// updateDelta adds the statistics of state x to the gradient with the given sign.
+func (d *DeepBoltzmannMachine) updateDelta(x [][]float64, sign float64) {
+	for k, l := range d.layers() {
+		for i := 0; i < l.Visible(); i++ {
+			for j := 0; j < l.Hidden(); j++ {
+				l.dw[i][j] += sign * x[k][i] * x[k+1][j] * l.iv[i]
+			}
+		}
+		if k == 0 {
+			for i := 0; i < l.Visible(); i++ {
+				l.dbv[i] += sign * x[k][i] * l.iv[i]
+			}
+		}
+		for j := 0; j < l.Hidden(); j++ {
+			l.dbh[j] += sign * x[k+1][j]
+		}
+	}
+}
+
+// FineTune trains all layers jointly, where the positive phase uses mean-field posteriors and the negative phase
+// uses one persistent markov chain for each example in a mini-batch.
+func (d *DeepBoltzmannMachine) FineTune(input [][]float64, opt *Option) {
+	if len(d.chain) != opt.BatchSize {
+		d.chain = make([][][]float64, opt.BatchSize)
+		for c := range d.chain {
+			d.chain[c] = newState(d.units())
+		}
+	}
+	train(d, len(input), opt, func(i int) {
+		d.updateDelta(d.MeanField(input[i]), 1)
+		x := d.chain[i%opt.BatchSize]
+		d.gibbs(x, opt.GibbsStep)
+		d.updateDelta(x, -1)
+	})
+}
+
+// Generate returns expected input after alternating gibbs sampling of all layers for the given number of steps.
+func (d *DeepBoltzmannMachine) Generate(step int) []float64 {
+	for k := range d.x {
+		for j := range d.x[k] {
+			d.x[k][j] = 0
+		}
+	}
+	d.gibbs(d.x, step)
+	l := d.layers()[0]
+	for i := 0; i < l.Visible(); i++ {
+		e := d.energy(0, i, d.x)
+		if l.vt[i] == GaussianUnit {
+			d.x[0][i] = e
+		} else {
+			d.x[0][i] = sigmoid(e)
+		}
+	}
+	return d.x[0]
+}
+
+// LoadDeepBoltzmannMachine creates a deep boltzmann machine from a model written by WriteTo
+// without knowing its architecture beforehand.
+func LoadDeepBoltzmannMachine(r io.Reader) (*DeepBoltzmannMachine, error) {
+	withGaussian, units, err := readArchitecture(r, 2)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDeepBoltzmannMachine(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	err = d.readLayers(r)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DeepBoltzmannMachine) ReadFrom(r io.Reader) (err error) {
+	withGaussian, units, err := readArchitecture(r, 2)
+	if err != nil {
+		return
+	}
+	if !d.sameArchitecture(withGaussian, units, d.units()) {
+		return ErrInvalidArchitecture
+	}
+	return d.readLayers(r)
+}
+
+// line 1: whether the bottom layer is gaussian, and the number of layer units
+//
+// line 2: unit count of each layer separated by space
+//
+// line N: each layer from bottom to top
+func (d *DeepBoltzmannMachine) WriteTo(w io.Writer) (err error) {
+	err = d.writeHeader(w, d.units())
+	if err != nil {
+		return
+	}
+	return d.writeLayers(w)
+}
@@ -0,0 +1,93 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDeepBoltzmannMachineTrain(t *testing.T) {
+	d, err := NewDeepBoltzmannMachine(false, 8, 12, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prototype, input, _ := prototypes(60, 0.05)
+	opt := &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	}
+	d.Train(input, opt)
+	// more gibbs steps help persistent chains mix
+	opt.GibbsStep = 5
+	d.FineTune(input, opt)
+
+	// Samples should be close to one of the prototypes.
+	var dist float64
+	for n := 0; n < 100; n++ {
+		v := d.Generate(20)
+		p := prototype[closest(v, prototype)]
+		for i := range p {
+			dist += math.Abs(v[i]-p[i]) / 100
+		}
+	}
+	t.Logf("average distance to the closest prototype %f", dist)
+	if dist > 1.5 {
+		t.Fatalf("samples are not close to training data")
+	}
+
+	// Mean-field posteriors of different prototypes should differ.
+	var mu [][]float64
+	for _, layer := range d.MeanField(prototype[0])[1:] {
+		mu = append(mu, append([]float64(nil), layer...))
+	}
+	var diff float64
+	for k, layer := range d.MeanField(prototype[2])[1:] {
+		for j := range layer {
+			diff += math.Abs(layer[j] - mu[k][j])
+		}
+	}
+	t.Logf("difference of posteriors %f", diff)
+	if diff < 2 {
+		t.Fatalf("hidden layers do not distinguish prototypes")
+	}
+}
+
+func TestDeepBoltzmannMachineMarshal(t *testing.T) {
+	d, err := NewDeepBoltzmannMachine(true, 4, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = d.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := LoadDeepBoltzmannMachine(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d2) {
+		t.Fatalf("not equal")
+	}
+	d3, err := NewDeepBoltzmannMachine(true, 4, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, d3) {
+		t.Fatalf("not equal")
+	}
+	d4, err := NewDeepBoltzmannMachine(true, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d4.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
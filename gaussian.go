@@ -1,5 +1,9 @@
 package rbm
 
+import (
+	"math"
+)
+
 type Gaussian struct {
 	*rbm
 }
@@ -7,7 +11,63 @@ type Gaussian struct {
 func NewGaussian(visible, hidden int) *Gaussian {
 	m := &Gaussian{rbm: newRBM(visible, hidden)}
 	for i := 0; i < m.Visible(); i++ {
-		m.vt[i] = gaussianUnit
+		m.vt[i] = GaussianUnit
 	}
 	return m
 }
+
+// NewGaussianVariance creates a gaussian rbm that also learns the variance of each visible unit,
+// so the data does not need to be standardized first.
+func NewGaussianVariance(visible, hidden int) *Gaussian {
+	m := NewGaussian(visible, hidden)
+	m.learnVariance = true
+	return m
+}
+
+// initVariance sets the visible biases and log variances of a model that is not trained yet to the mean and
+// log variance of data, so that learning the variance is stable on data that is not standardized. Missing
+// units are skipped, and missing can be nil.
+func (m *Gaussian) initVariance(data [][]float64, missing [][]bool) {
+	if !m.learnVariance {
+		return
+	}
+	for i := 0; i < m.Visible(); i++ {
+		if m.bv[i] != 0 || m.z[i] != 0 {
+			return
+		}
+	}
+	for i := 0; i < m.Visible(); i++ {
+		var n, sum, sum2 float64
+		for k, v := range data {
+			if missing != nil && missing[k] != nil && missing[k][i] {
+				continue
+			}
+			n++
+			sum += v[i]
+			sum2 += v[i] * v[i]
+		}
+		if n < 2 {
+			continue
+		}
+		mean := sum / n
+		variance := sum2/n - mean*mean
+		if variance <= 0 {
+			continue
+		}
+		m.bv[i] = mean
+		m.z[i] = math.Log(variance)
+	}
+	m.updateVariance()
+}
+
+// Train learns from data. With learned variance, the model is first initialized from data with initVariance.
+func (m *Gaussian) Train(data [][]float64, opt *Option) {
+	m.initVariance(data, nil)
+	m.rbm.Train(data, opt)
+}
+
+// TrainMissing is Train with missing units, where the model is first initialized from the present units.
+func (m *Gaussian) TrainMissing(data [][]float64, missing [][]bool, opt *Option) {
+	m.initVariance(data, missing)
+	m.rbm.TrainMissing(data, missing, opt)
+}
@@ -67,3 +67,204 @@ func TestGaussianMarshal(t *testing.T) {
 		t.Fatalf("not equal")
 	}
 }
+
+func TestGaussianReLUTrain(t *testing.T) {
+	shift1, shift2 := 3.0, -2.0
+	m := NewGaussian(2, 11)
+	err := m.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data [][]float64
+	for i := 0; i < 100; i++ {
+		data = append(data, []float64{rand.NormFloat64() + shift1, rand.NormFloat64() + shift2})
+	}
+
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 20,
+		GibbsStep: 10,
+	})
+
+	total := 1000
+	for _, test := range []struct {
+		in []float64
+	}{
+		{
+			in: []float64{shift1, shift2},
+		},
+		{
+			in: []float64{0.1 + shift1, -0.1 + shift2},
+		},
+		{
+			in: []float64{-0.1 + shift1, 0.1 + shift2},
+		},
+	} {
+		for _, h := range m.ph(test.in) {
+			if h < 0 {
+				t.Fatalf("negative hidden activation %f", h)
+			}
+		}
+		var count int
+		for i := 0; i < total; i++ {
+			got, _ := m.Reconstruct(test.in, 2)
+			// mean +- 3 stddev
+			if math.Abs(got[0]-shift1) > 3 || math.Abs(got[1]-shift2) > 3 {
+				count++
+			}
+		}
+		errRate := float64(count) / float64(total)
+		if errRate > 0.02 {
+			t.Fatalf("reconstruct error rate %f", errRate)
+		}
+	}
+}
+
+func TestSetHiddenInvalid(t *testing.T) {
+	m := NewGaussian(2, 3)
+	err := m.SetHidden(SoftmaxUnit)
+	if err != ErrInvalidUnit {
+		t.Fatalf("expect %v, got %v", ErrInvalidUnit, err)
+	}
+}
+
+func TestGaussianVarianceGradient(t *testing.T) {
+	m := NewGaussianVariance(2, 3)
+	for i := 0; i < m.Visible(); i++ {
+		m.bv[i] = rand.NormFloat64()
+		m.z[i] = rand.NormFloat64()
+		for j := 0; j < m.Hidden(); j++ {
+			m.w[i][j] = rand.NormFloat64()
+		}
+	}
+	m.updateVariance()
+	v, h := []float64{1.5, -0.5}, []float64{1, 0, 1}
+	rv, rh := []float64{0.2, 1}, []float64{0.3, 0.6, 0.1}
+	// negative energy with visible variance exp(z)
+	energy := func(v, h []float64) float64 {
+		var e float64
+		for i := range v {
+			iv := math.Exp(-m.z[i])
+			e -= (v[i] - m.bv[i]) * (v[i] - m.bv[i]) * iv / 2
+			for j := range h {
+				e += v[i] * iv * m.w[i][j] * h[j]
+			}
+		}
+		for j := range h {
+			e += m.bh[j] * h[j]
+		}
+		return e
+	}
+	m.resetDelta()
+	m.updateDelta(v, rv, h, rh, 1)
+
+	delta := 1e-6
+	for i := range m.z {
+		old := m.z[i]
+		m.z[i] = old + delta
+		f1 := energy(v, h) - energy(rv, rh)
+		m.z[i] = old - delta
+		f2 := energy(v, h) - energy(rv, rh)
+		m.z[i] = old
+		got := (f1 - f2) / (2 * delta)
+		if math.Abs(got-m.dz[i]) > 1e-5 {
+			t.Fatalf("unit %d: expect gradient %f, got %f", i, m.dz[i], got)
+		}
+	}
+}
+
+func TestGaussianVarianceTrain(t *testing.T) {
+	// The data is not standardized.
+	mean := []float64{100, -5}
+	stdev := []float64{20, 0.5}
+	var data [][]float64
+	for i := 0; i < 500; i++ {
+		data = append(data, []float64{
+			rand.NormFloat64()*stdev[0] + mean[0],
+			rand.NormFloat64()*stdev[1] + mean[1],
+		})
+	}
+	for _, fresh := range []bool{true, false} {
+		testGaussianVarianceTrain(t, data, mean, stdev, fresh)
+	}
+}
+
+// testGaussianVarianceTrain trains on data from a fresh model, or otherwise from variances far from the data,
+// which then have to be learned.
+func testGaussianVarianceTrain(t *testing.T, data [][]float64, mean, stdev []float64, fresh bool) {
+	m := NewGaussianVariance(2, 11)
+	if !fresh {
+		for i := range mean {
+			m.bv[i] = mean[i]
+			m.z[i] = math.Log(stdev[i]*stdev[i]) + 3
+		}
+		m.updateVariance()
+	}
+
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 10,
+	})
+
+	total := 1000
+	var sum, sum2 [2]float64
+	for i := 0; i < total; i++ {
+		got, _ := m.Reconstruct(data[i%len(data)], 2)
+		for j := range got {
+			sum[j] += got[j]
+			sum2[j] += got[j] * got[j]
+		}
+	}
+	for j := range stdev {
+		sigma := math.Exp(m.z[j] / 2)
+		if sigma < stdev[j]/2 || sigma > 2*stdev[j] {
+			t.Fatalf("fresh %t, unit %d: expect stdev %f, got %f", fresh, j, stdev[j], sigma)
+		}
+		mu := sum[j] / float64(total)
+		if math.Abs(mu-mean[j]) > stdev[j] {
+			t.Fatalf("fresh %t, unit %d: expect mean %f, got %f", fresh, j, mean[j], mu)
+		}
+		got := math.Sqrt(sum2[j]/float64(total) - mu*mu)
+		if got < stdev[j]/2 || got > 2*stdev[j] {
+			t.Fatalf("fresh %t, unit %d: expect reconstructed stdev %f, got %f", fresh, j, stdev[j], got)
+		}
+	}
+}
+
+func TestGaussianVarianceMarshal(t *testing.T) {
+	m := NewGaussianVariance(3, 2)
+	for i := range m.z {
+		m.z[i] = rand.NormFloat64()
+	}
+	m.updateVariance()
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	m2 := NewGaussianVariance(3, 2)
+	err = m2.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+
+	// Whether variance is learned must match in both directions.
+	err = NewGaussian(3, 2).ReadFrom(bytes.NewReader(data))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+	buf.Reset()
+	err = NewGaussian(3, 2).WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewGaussianVariance(3, 2).ReadFrom(buf)
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
@@ -0,0 +1,210 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+)
+
+type segment struct {
+	t      UnitType
+	n      int
+	trials int // only for BinomialUnit
+}
+
+// Layout describes the visible units of a mixed rbm as consecutive ranges of one unit type.
+type Layout struct {
+	segments []segment
+}
+
+// Add appends n visible units of type t. For SoftmaxUnit, the n units form one categorical variable.
+func (l *Layout) Add(t UnitType, n int) *Layout {
+	l.segments = append(l.segments, segment{t: t, n: n})
+	return l
+}
+
+func (l *Layout) Binary(n int) *Layout {
+	return l.Add(BinaryUnit, n)
+}
+
+func (l *Layout) Gaussian(n int) *Layout {
+	return l.Add(GaussianUnit, n)
+}
+
+func (l *Layout) Softmax(n int) *Layout {
+	return l.Add(SoftmaxUnit, n)
+}
+
+func (l *Layout) Poisson(n int) *Layout {
+	return l.Add(PoissonUnit, n)
+}
+
+func (l *Layout) ConstrainedPoisson(n int) *Layout {
+	return l.Add(ConstrainedPoissonUnit, n)
+}
+
+// Binomial appends n binomial visible units with the given number of trials.
+func (l *Layout) Binomial(n, trials int) *Layout {
+	l.segments = append(l.segments, segment{t: BinomialUnit, n: n, trials: trials})
+	return l
+}
+
+func (l *Layout) Visible() int {
+	var n int
+	for _, s := range l.segments {
+		n += s.n
+	}
+	return n
+}
+
+// Mixed is an rbm with visible units of different types, which models heterogeneous rows directly.
+type Mixed struct {
+	*rbm
+
+	layout *Layout
+}
+
+func NewMixed(layout *Layout, hidden int) (*Mixed, error) {
+	for _, s := range layout.segments {
+		switch s.t {
+		case BinaryUnit, GaussianUnit, SoftmaxUnit, PoissonUnit, ConstrainedPoissonUnit:
+		case BinomialUnit:
+			if s.trials <= 0 {
+				return nil, ErrInvalidUnit
+			}
+		default:
+			return nil, ErrInvalidUnit
+		}
+		if s.n <= 0 {
+			return nil, ErrInvalidUnit
+		}
+	}
+	m := &Mixed{
+		rbm:    newRBM(layout.Visible(), hidden),
+		layout: &Layout{segments: append([]segment(nil), layout.segments...)},
+	}
+	var start int
+	for _, s := range layout.segments {
+		units := make([]int, s.n)
+		for i := 0; i < s.n; i++ {
+			units[i] = start + i
+		}
+		switch s.t {
+		case SoftmaxUnit:
+			m.addSoftmax(units)
+		case PoissonUnit, ConstrainedPoissonUnit:
+			m.setPoisson(units, s.t == ConstrainedPoissonUnit)
+		case BinomialUnit:
+			m.setBinomial(units, s.trials)
+		default:
+			for _, u := range units {
+				m.vt[u] = s.t
+			}
+		}
+		start += s.n
+	}
+	return m, nil
+}
+
+func readLayout(r io.Reader) (layout *Layout, hidden UnitType, err error) {
+	var n int
+	_, err = fmt.Fscan(r, &n, &hidden)
+	if err != nil {
+		return
+	}
+	layout = new(Layout)
+	for i := 0; i < n; i++ {
+		var s segment
+		_, err = fmt.Fscan(r, &s.t, &s.n)
+		if err != nil {
+			return
+		}
+		if s.t == BinomialUnit {
+			_, err = fmt.Fscan(r, &s.trials)
+			if err != nil {
+				return
+			}
+		}
+		layout.segments = append(layout.segments, s)
+	}
+	return
+}
+
+// LoadMixed creates a mixed rbm from a model written by WriteTo without knowing its layout beforehand.
+func LoadMixed(r io.Reader) (*Mixed, error) {
+	layout, hidden, err := readLayout(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMixed(layout, h.hidden)
+	if err != nil {
+		return nil, err
+	}
+	err = m.SetHidden(hidden)
+	if err != nil {
+		return nil, err
+	}
+	if !m.matches(h) {
+		return nil, ErrInvalidArchitecture
+	}
+	err = m.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Mixed) ReadFrom(r io.Reader) (err error) {
+	layout, hidden, err := readLayout(r)
+	if err != nil {
+		return
+	}
+	if hidden != m.hiddenType() || len(layout.segments) != len(m.layout.segments) {
+		return ErrInvalidArchitecture
+	}
+	for i := range layout.segments {
+		if layout.segments[i] != m.layout.segments[i] {
+			return ErrInvalidArchitecture
+		}
+	}
+	return m.rbm.ReadFrom(r)
+}
+
+// line 1: number of layout segments and hidden unit type
+//
+// line 2: unit type and unit count of each segment separated by space, followed by the number of
+// trials for binomial units
+//
+// line N: rbm
+func (m *Mixed) WriteTo(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "%d %d\n", len(m.layout.segments), m.hiddenType())
+	if err != nil {
+		return
+	}
+	for i, s := range m.layout.segments {
+		if i > 0 {
+			_, err = fmt.Fprint(w, " ")
+			if err != nil {
+				return
+			}
+		}
+		_, err = fmt.Fprintf(w, "%d %d", s.t, s.n)
+		if err != nil {
+			return
+		}
+		if s.t == BinomialUnit {
+			_, err = fmt.Fprintf(w, " %d", s.trials)
+			if err != nil {
+				return
+			}
+		}
+	}
+	_, err = fmt.Fprint(w, "\n")
+	if err != nil {
+		return
+	}
+	return m.rbm.WriteTo(w)
+}
@@ -0,0 +1,107 @@
+package rbm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMixedTrain(t *testing.T) {
+	layout := new(Layout).Gaussian(1).Binary(2).Softmax(3)
+	m, err := NewMixed(layout, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each row is one of 3 clusters: a gaussian column centered at the cluster,
+	// 2 binary flags and the cluster as categorical column.
+	clusters := [][]float64{
+		{-2, 1, 0, 1, 0, 0},
+		{0, 0, 1, 0, 1, 0},
+		{2, 1, 1, 0, 0, 1},
+	}
+	var data [][]float64
+	for i := 0; i < 300; i++ {
+		row := make([]float64, 6)
+		copy(row, clusters[i%len(clusters)])
+		row[0] += 0.3 * rand.NormFloat64()
+		data = append(data, row)
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	})
+
+	total := 1000
+	for _, test := range clusters {
+		var count int
+		for i := 0; i < total; i++ {
+			got, _ := m.Reconstruct(test, 2)
+			// mean +- 3 stddev
+			if math.Abs(got[0]-test[0]) > 3 || !reflect.DeepEqual(got[1:], test[1:]) {
+				count++
+			}
+		}
+		errRate := float64(count) / float64(total)
+		if errRate > 0.1 {
+			t.Fatalf("reconstruct error rate %f", errRate)
+		}
+	}
+}
+
+func TestMixedInvalid(t *testing.T) {
+	for _, layout := range []*Layout{
+		new(Layout).Binary(2).Add(ReLUUnit, 2),
+		new(Layout).Binary(0),
+	} {
+		_, err := NewMixed(layout, 2)
+		if err != ErrInvalidUnit {
+			t.Fatalf("expect %v, got %v", ErrInvalidUnit, err)
+		}
+	}
+}
+
+func TestMixedMarshal(t *testing.T) {
+	layout := new(Layout).Gaussian(2).Binary(3).Softmax(2).Softmax(3).Binomial(2, 255).ConstrainedPoisson(3)
+	m, err := NewMixed(layout, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := LoadMixed(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+
+	m3, err := NewMixed(new(Layout).Gaussian(2).Binary(3).Softmax(5), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+
+	// The rbm header must agree with the layout.
+	lines := strings.SplitN(buf.String(), "\n", 4)
+	lines[2] = strings.Replace(lines[2], fmt.Sprint(layout.Visible()), fmt.Sprint(layout.Visible()+1), 1)
+	_, err = LoadMixed(strings.NewReader(strings.Join(lines, "\n")))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
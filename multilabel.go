@@ -0,0 +1,139 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Number of mean-field updates of label probabilities.
+const multiLabelStep = 10
+
+// MultiLabel is a classifier where each example can have several labels. Labels are independent binary
+// units that are trained jointly with the input.
+type MultiLabel struct {
+	*rbm
+
+	b         []float64
+	p         []float64 // label probability
+	hb        []float64 // hidden energy
+	active    []int     // labels above threshold
+	threshold []float64 // threshold of each label
+	input     int
+	output    int
+}
+
+func NewMultiLabel(input, output, hidden int) *MultiLabel {
+	m := &MultiLabel{
+		rbm:       newRBM(input+output, hidden),
+		b:         make([]float64, input+output),
+		p:         make([]float64, output),
+		hb:        make([]float64, hidden),
+		active:    make([]int, 0, output),
+		threshold: make([]float64, output),
+		input:     input,
+		output:    output,
+	}
+	for i := 0; i < output; i++ {
+		m.threshold[i] = 0.5
+	}
+	return m
+}
+
+func (m *MultiLabel) Input() int {
+	return m.input
+}
+
+func (m *MultiLabel) Output() int {
+	return m.output
+}
+
+// SetThreshold changes the minimum probability for a label to be active. The default is 0.5.
+func (m *MultiLabel) SetThreshold(label int, threshold float64) {
+	m.threshold[label] = threshold
+}
+
+func (m *MultiLabel) vis(input []float64, labels []int) []float64 {
+	copy(m.b, input)
+	for i := 0; i < m.Output(); i++ {
+		m.b[m.Input()+i] = 0
+	}
+	for _, n := range labels {
+		m.b[m.Input()+n] = 1
+	}
+	return m.b
+}
+
+// Train learns the joint distribution of input and labels, where output[i] are the labels of input[i].
+func (m *MultiLabel) Train(input [][]float64, output [][]int, opt *Option) {
+	train(m, len(input), opt, func(i int) {
+		m.cd(opt.GibbsStep, m.vis(input[i], output[i]))
+	})
+}
+
+// Probabilities returns the probability of each label given input. The probability of label k is
+// sigmoid(F(x, y_k = 0) - F(x, y_k = 1)), where the other labels are set to their probabilities with
+// mean-field updates.
+func (m *MultiLabel) Probabilities(input []float64) []float64 {
+	v := m.vis(input, nil)
+	// hb includes the current label probabilities.
+	for j := 0; j < m.Hidden(); j++ {
+		m.hb[j] = m.eh(j, v)
+	}
+	for k := 0; k < m.Output(); k++ {
+		m.p[k] = 0
+	}
+	for s := 0; s < multiLabelStep; s++ {
+		for k := 0; k < m.Output(); k++ {
+			w := m.w[m.Input()+k]
+			// free energy difference of turning label k on
+			f := -m.bv[m.Input()+k]
+			for j := 0; j < m.Hidden(); j++ {
+				e := m.hb[j] - w[j]*m.p[k]
+				f += m.freeEnergyHidden(j, e+w[j]) - m.freeEnergyHidden(j, e)
+			}
+			p := sigmoid(-f)
+			for j := 0; j < m.Hidden(); j++ {
+				m.hb[j] += w[j] * (p - m.p[k])
+			}
+			m.p[k] = p
+		}
+	}
+	return m.p
+}
+
+// Classify returns labels whose probability is not less than their threshold.
+func (m *MultiLabel) Classify(input []float64) []int {
+	p := m.Probabilities(input)
+	m.active = m.active[:0]
+	for k := 0; k < m.Output(); k++ {
+		if p[k] >= m.threshold[k] {
+			m.active = append(m.active, k)
+		}
+	}
+	return m.active
+}
+
+// line 1: rbm
+//
+// line N: threshold of each label separated by space
+func (m *MultiLabel) WriteTo(w io.Writer) (err error) {
+	err = m.rbm.WriteTo(w)
+	if err != nil {
+		return
+	}
+	return writeSlice(w, m.threshold)
+}
+
+func (m *MultiLabel) ReadFrom(r io.Reader) (err error) {
+	err = m.rbm.ReadFrom(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < m.Output(); i++ {
+		_, err = fmt.Fscan(r, &m.threshold[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package rbm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMultiLabelTrain(t *testing.T) {
+	m := NewMultiLabel(4, 3, 16)
+	var (
+		input  [][]float64
+		output [][]int
+	)
+	// label 0 is bit 0, label 1 is bit 1 and bit 2, label 2 is bit 3
+	labels := func(in []float64) []int {
+		out := []int{}
+		if in[0] == 1 {
+			out = append(out, 0)
+		}
+		if in[1] == 1 && in[2] == 1 {
+			out = append(out, 1)
+		}
+		if in[3] == 1 {
+			out = append(out, 2)
+		}
+		return out
+	}
+	for i := 0; i < 16; i++ {
+		in := make([]float64, 4)
+		for j := 0; j < 4; j++ {
+			in[j] = float64(i >> uint(j) & 1)
+		}
+		input = append(input, in)
+		output = append(output, labels(in))
+	}
+	m.Train(input, output, &Option{
+		BatchSize: 4,
+		Iteration: 2000,
+		GibbsStep: 1,
+	})
+
+	var wrong int
+	for i, in := range input {
+		got := m.Classify(in)
+		if !reflect.DeepEqual(got, output[i]) {
+			t.Logf("%v: expect %v, got %v", in, output[i], got)
+			wrong++
+		}
+	}
+	if wrong > 2 {
+		t.Fatalf("%d of %d examples are wrong", wrong, len(input))
+	}
+}
+
+func TestMultiLabelThreshold(t *testing.T) {
+	m := NewMultiLabel(2, 2, 3)
+	in := []float64{1, 0}
+	p := m.Probabilities(in)
+	m.SetThreshold(0, p[0]+0.01)
+	m.SetThreshold(1, p[1]-0.01)
+	got := m.Classify(in)
+	if want := []int{1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+}
+
+func TestMultiLabelMarshal(t *testing.T) {
+	m := NewMultiLabel(4, 3, 2)
+	m.SetThreshold(1, 0.3)
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewMultiLabel(4, 3, 2)
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+}
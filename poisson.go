@@ -0,0 +1,55 @@
+package rbm
+
+import (
+	"math"
+)
+
+// Poisson is an rbm with poisson visible units for count data.
+type Poisson struct {
+	*rbm
+}
+
+func newPoisson(visible, hidden int, constrained bool) *Poisson {
+	m := &Poisson{rbm: newRBM(visible, hidden)}
+	units := make([]int, visible)
+	for i := range units {
+		units[i] = i
+	}
+	m.setPoisson(units, constrained)
+	return m
+}
+
+func NewPoisson(visible, hidden int) *Poisson {
+	return newPoisson(visible, hidden, false)
+}
+
+// NewConstrainedPoisson creates a constrained poisson model, which keeps the total count of
+// reconstructions equal to that of the input, for example the length of a document.
+func NewConstrainedPoisson(visible, hidden int) *Poisson {
+	return newPoisson(visible, hidden, true)
+}
+
+// initRate sets the visible biases of a model that is not trained yet to the log of the mean count of each unit
+// in data, so that the weights learn the structure of the counts rather than their scale.
+func (m *Poisson) initRate(data [][]float64) {
+	for i := 0; i < m.Visible(); i++ {
+		if m.bv[i] != 0 {
+			return
+		}
+	}
+	for i := 0; i < m.Visible(); i++ {
+		var sum float64
+		for _, v := range data {
+			sum += v[i]
+		}
+		if sum > 0 {
+			m.bv[i] = math.Log(sum / float64(len(data)))
+		}
+	}
+}
+
+// Train learns from data, where the model is first initialized from data with initRate.
+func (m *Poisson) Train(data [][]float64, opt *Option) {
+	m.initRate(data)
+	m.rbm.Train(data, opt)
+}
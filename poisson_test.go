@@ -0,0 +1,94 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSamplePoisson(t *testing.T) {
+	total := 100000
+	for _, rate := range []float64{0.5, 3, 10, 50, 500} {
+		var sum, sum2 float64
+		for i := 0; i < total; i++ {
+			k := samplePoisson(rate)
+			if k < 0 || k != math.Floor(k) {
+				t.Fatalf("invalid sample %f", k)
+			}
+			sum += k
+			sum2 += k * k
+		}
+		mean := sum / float64(total)
+		variance := sum2/float64(total) - mean*mean
+		// Both mean and variance of a poisson distribution equal to its rate.
+		if math.Abs(mean-rate) > 0.02*rate+0.01 || math.Abs(variance-rate) > 0.05*rate+0.02 {
+			t.Fatalf("rate %f: got mean %f, variance %f", rate, mean, variance)
+		}
+	}
+}
+
+func TestSamplePoissonInvalid(t *testing.T) {
+	for _, rate := range []float64{math.NaN(), math.Inf(1), -1, 0} {
+		if k := samplePoisson(rate); k != 0 {
+			t.Fatalf("rate %f: expect 0, got %f", rate, k)
+		}
+	}
+}
+
+func TestPoissonTrain(t *testing.T) {
+	for _, count := range []float64{5, 20, 200} {
+		for n, m := range []*Poisson{
+			NewPoisson(4, 3),
+			NewConstrainedPoisson(4, 3),
+		} {
+			patterns := [][]float64{
+				{0, 0, count, count},
+				{count, count, 0, 0},
+			}
+			var data [][]float64
+			for i := 0; i < 100; i++ {
+				data = append(data, patterns[i%len(patterns)])
+			}
+			m.Train(data, &Option{
+				BatchSize: 10,
+				Iteration: 200,
+				GibbsStep: 1,
+			})
+
+			total := 1000
+			for _, test := range patterns {
+				var sum [4]float64
+				for i := 0; i < total; i++ {
+					got, _ := m.Reconstruct(test, 1)
+					for j := range got {
+						sum[j] += got[j]
+					}
+				}
+				for j := range sum {
+					mean := sum[j] / float64(total)
+					if math.Abs(mean-test[j]) > 0.25*count+0.5 {
+						t.Fatalf("model %d: expect %v, got mean %f of unit %d", n, test, mean, j)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPoissonMarshal(t *testing.T) {
+	m := NewConstrainedPoisson(3, 2)
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewConstrainedPoisson(3, 2)
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+}
@@ -1,10 +1,12 @@
 package rbm
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"strings"
 )
 
 const (
@@ -15,14 +17,33 @@ const (
 	// Use small random values for the weights chosen from a zero-mean Gaussian with a standard deviation
 	// of 0.01.
 	weightStdDev = 0.01
+	// Largest activation energy of poisson units, so that their rates stay finite.
+	maxPoissonEnergy = 30
 )
 
-type unitType uint8
+// UnitType is the type of a visible or hidden unit.
+type UnitType uint8
 
 const (
-	binaryUnit unitType = iota
-	gaussianUnit
-	softmaxUnit
+	BinaryUnit UnitType = iota
+	GaussianUnit
+	SoftmaxUnit
+	// Noisy rectified linear unit (Nair & Hinton, 2010). It can only be used as hidden unit.
+	ReLUUnit
+	// Truncated exponential unit with values in [0, 1]. It can only be used as hidden unit.
+	ExponentialUnit
+	// Poisson unit for counts with rate exp(x). It can only be used as visible unit.
+	PoissonUnit
+	// Poisson unit whose rates are normalized so that the expected total count of all constrained poisson
+	// units equals the total count of the input (Salakhutdinov & Hinton, 2009). It can only be used as visible unit.
+	ConstrainedPoissonUnit
+	// Binomial unit for bounded counts between 0 and the number of trials. It can only be used as visible unit.
+	BinomialUnit
+)
+
+var (
+	ErrInvalidUnit  = errors.New("unit type is not supported")
+	ErrInvalidGroup = errors.New("softmax group is out of range, overlaps with another, or has non-binary units")
 )
 
 type rbm struct {
@@ -32,12 +53,28 @@ type rbm struct {
 	v   []float64  // visible
 	bv  []float64  // bias visible
 	dbv []float64  // delta of bias visible
-	vt  []unitType // visible type
+	vt  []UnitType // visible type
+	z   []float64  // log variance of visible
+	dz  []float64  // delta of log variance of visible
+	iv  []float64  // inverse variance of visible, exp(-z)
+	sg  [][]int    // softmax groups of visible
+	pg  []int      // constrained poisson units of visible
+	bn  []int      // number of trials of binomial visible
+	ov  []float64  // offset of bias visible, e.g. from autoregressive connections
+	mv  []float64  // visible with missing units imputed
+
+	// Missing visible units of the current example, which do not contribute to the gradient.
+	missing []bool
+
+	// Whether the variance of gaussian visible units is learned instead of fixed to 1.
+	learnVariance bool
 
-	h   []float64 // hidden
-	rh  []float64 // hidden (added for contrastive divergence)
-	bh  []float64 // bias hidden
-	dbh []float64 // delta of bias hidden
+	h   []float64  // hidden
+	rh  []float64  // hidden (added for contrastive divergence)
+	bh  []float64  // bias hidden
+	dbh []float64  // delta of bias hidden
+	ht  []UnitType // hidden type
+	oh  []float64  // offset of bias hidden
 }
 
 func newRBM(visible, hidden int) *rbm {
@@ -55,12 +92,20 @@ func newRBM(visible, hidden int) *rbm {
 		v:   make([]float64, visible),
 		bv:  make([]float64, visible),
 		dbv: make([]float64, visible),
-		vt:  make([]unitType, visible),
+		vt:  make([]UnitType, visible),
+		z:   make([]float64, visible),
+		dz:  make([]float64, visible),
+		iv:  make([]float64, visible),
+		bn:  make([]int, visible),
+		ov:  make([]float64, visible),
+		mv:  make([]float64, visible),
 
 		h:   make([]float64, hidden),
 		rh:  make([]float64, hidden),
 		bh:  make([]float64, hidden),
 		dbh: make([]float64, hidden),
+		ht:  make([]UnitType, hidden),
+		oh:  make([]float64, hidden),
 	}
 	m.Reset()
 	return m
@@ -75,6 +120,7 @@ func (m *rbm) resetDelta() {
 
 	for i := 0; i < m.Visible(); i++ {
 		m.dbv[i] = 0
+		m.dz[i] = 0
 	}
 
 	for i := 0; i < m.Hidden(); i++ {
@@ -93,6 +139,8 @@ func (m *rbm) Reset() {
 	for i := 0; i < m.Visible(); i++ {
 		m.v[i] = 0
 		m.bv[i] = 0
+		m.z[i] = 0
+		m.iv[i] = 1
 	}
 
 	// TODO: Set the visible biases to log[pi/(1−pi)] where pi
@@ -104,6 +152,69 @@ func (m *rbm) Reset() {
 	}
 }
 
+// SetHidden changes the type of all hidden units. SoftmaxUnit is not supported.
+//
+// Gaussian hidden units with unit variance are linear, and are useful as the low-dimensional code
+// of an autoencoder.
+func (m *rbm) SetHidden(t UnitType) error {
+	switch t {
+	case BinaryUnit, GaussianUnit, ReLUUnit, ExponentialUnit:
+	default:
+		return ErrInvalidUnit
+	}
+	for i := 0; i < m.Hidden(); i++ {
+		m.ht[i] = t
+	}
+	return nil
+}
+
+// SetSoftmax declares the given binary visible units as one softmax group, which is a categorical variable
+// with exactly one unit on. Each group is normalized and sampled independently.
+func (m *rbm) SetSoftmax(units ...int) error {
+	if len(units) == 0 {
+		return ErrInvalidGroup
+	}
+	for i, u := range units {
+		if u < 0 || u >= m.Visible() || m.vt[u] != BinaryUnit {
+			return ErrInvalidGroup
+		}
+		for _, u2 := range units[:i] {
+			if u == u2 {
+				return ErrInvalidGroup
+			}
+		}
+	}
+	m.addSoftmax(units)
+	return nil
+}
+
+func (m *rbm) addSoftmax(units []int) {
+	group := make([]int, len(units))
+	copy(group, units)
+	for _, u := range group {
+		m.vt[u] = SoftmaxUnit
+	}
+	m.sg = append(m.sg, group)
+}
+
+func (m *rbm) setPoisson(units []int, constrained bool) {
+	for _, u := range units {
+		if constrained {
+			m.vt[u] = ConstrainedPoissonUnit
+			m.pg = append(m.pg, u)
+		} else {
+			m.vt[u] = PoissonUnit
+		}
+	}
+}
+
+func (m *rbm) setBinomial(units []int, trials int) {
+	for _, u := range units {
+		m.vt[u] = BinomialUnit
+		m.bn[u] = trials
+	}
+}
+
 func writeSlice(w io.Writer, v []float64) (err error) {
 	for i := 0; i < len(v); i++ {
 		if i > 0 {
@@ -121,19 +232,55 @@ func writeSlice(w io.Writer, v []float64) (err error) {
 	return
 }
 
-// line 1: visible and hidden unit count
+func writeInts(w io.Writer, v []int) (err error) {
+	for i := 0; i < len(v); i++ {
+		if i > 0 {
+			_, err = fmt.Fprint(w, " ")
+			if err != nil {
+				return
+			}
+		}
+		_, err = fmt.Fprint(w, v[i])
+		if err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprint(w, "\n")
+	return
+}
+
+// hiddenType returns the type of hidden units, which SetHidden sets for all of them.
+func (m *rbm) hiddenType() UnitType {
+	if m.Hidden() == 0 {
+		return BinaryUnit
+	}
+	return m.ht[0]
+}
+
+// line 1: visible and hidden unit count, hidden type, whether variance is learned, and number of softmax groups
+//
+// line N: units of each softmax group separated by space
+//
+// line N+1: visible bias separated by space
 //
-// line 2: visible bias separated by space
+// line N+2: hidden bias separated by space
 //
-// line 3: hidden bias separated by space
+// line N+3: weight separated by space
 //
-// line N: weight separated by space
+// line N+4: log variance of visible separated by space, only if variance is learned
 func (m *rbm) WriteTo(w io.Writer) (err error) {
-	_, err = fmt.Fprintf(w, "%d %d\n", m.Visible(), m.Hidden())
+	_, err = fmt.Fprintf(w, "%d %d %d %t %d\n", m.Visible(), m.Hidden(), m.hiddenType(), m.learnVariance, len(m.sg))
 	if err != nil {
 		return
 	}
 
+	for _, group := range m.sg {
+		err = writeInts(w, group)
+		if err != nil {
+			return
+		}
+	}
+
 	err = writeSlice(w, m.bv)
 	if err != nil {
 		return
@@ -150,16 +297,130 @@ func (m *rbm) WriteTo(w io.Writer) (err error) {
 			return
 		}
 	}
+
+	if m.learnVariance {
+		err = writeSlice(w, m.z)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readLine reads the next non-empty line one byte at a time, so that nothing after the line is consumed.
+func readLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    [1]byte
+	)
+	for {
+		_, err := io.ReadFull(r, b[:])
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+		if b[0] == '\n' {
+			if len(strings.TrimSpace(string(line))) > 0 {
+				return string(line), nil
+			}
+			line = line[:0]
+			continue
+		}
+		line = append(line, b[0])
+	}
+}
+
+// header is the unit count line of a model, followed by its softmax groups.
+type header struct {
+	visible, hidden int
+	hiddenType      UnitType
+	learnVariance   bool
+	softmax         [][]int
+	// Models written before the hidden type was recorded have only the unit counts.
+	full bool
+}
+
+func readHeader(r io.Reader) (h header, err error) {
+	line, err := readLine(r)
+	if err != nil {
+		return
+	}
+	switch len(strings.Fields(line)) {
+	case 2:
+		_, err = fmt.Sscan(line, &h.visible, &h.hidden)
+		return
+	case 5:
+	default:
+		err = ErrInvalidArchitecture
+		return
+	}
+	var groups int
+	_, err = fmt.Sscan(line, &h.visible, &h.hidden, &h.hiddenType, &h.learnVariance, &groups)
+	if err != nil {
+		return
+	}
+	if groups < 0 || groups > h.visible {
+		err = ErrInvalidArchitecture
+		return
+	}
+	h.full = true
+	h.softmax = make([][]int, groups)
+	for k := range h.softmax {
+		line, err = readLine(r)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		h.softmax[k] = make([]int, len(fields))
+		for i, f := range fields {
+			_, err = fmt.Sscan(f, &h.softmax[k][i])
+			if err != nil {
+				return
+			}
+		}
+	}
 	return
 }
 
+// matches returns whether a model with header h can be read into m.
+func (m *rbm) matches(h header) bool {
+	if h.visible != m.Visible() || h.hidden != m.Hidden() {
+		return false
+	}
+	if !h.full {
+		return true
+	}
+	if h.hiddenType != m.hiddenType() || h.learnVariance != m.learnVariance || len(h.softmax) != len(m.sg) {
+		return false
+	}
+	for k, group := range m.sg {
+		if len(h.softmax[k]) != len(group) {
+			return false
+		}
+		for i := range group {
+			if h.softmax[k][i] != group[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (m *rbm) ReadFrom(r io.Reader) (err error) {
-	var visible, hidden int
-	_, err = fmt.Fscan(r, &visible, &hidden)
+	h, err := readHeader(r)
 	if err != nil {
 		return
 	}
+	if !m.matches(h) {
+		return ErrInvalidArchitecture
+	}
+	return m.readBody(r)
+}
 
+// readBody reads everything after the unit count line.
+func (m *rbm) readBody(r io.Reader) (err error) {
 	for i := 0; i < m.Visible(); i++ {
 		_, err = fmt.Fscan(r, &m.bv[i])
 		if err != nil {
@@ -182,9 +443,25 @@ func (m *rbm) ReadFrom(r io.Reader) (err error) {
 			}
 		}
 	}
+
+	if m.learnVariance {
+		for i := 0; i < m.Visible(); i++ {
+			_, err = fmt.Fscan(r, &m.z[i])
+			if err != nil {
+				return
+			}
+		}
+		m.updateVariance()
+	}
 	return
 }
 
+func (m *rbm) updateVariance() {
+	for i := 0; i < m.Visible(); i++ {
+		m.iv[i] = math.Exp(-m.z[i])
+	}
+}
+
 func (m *rbm) Visible() int {
 	return len(m.v)
 }
@@ -197,6 +474,10 @@ func sigmoid(x float64) float64 {
 	return 1 / (1 + math.Exp(-x))
 }
 
+func softplus(x float64) float64 {
+	return math.Log(1 + math.Exp(x))
+}
+
 func sample(x float64) float64 {
 	if x > rand.Float64() {
 		return 1
@@ -204,35 +485,90 @@ func sample(x float64) float64 {
 	return 0
 }
 
-func softmax(x []float64, mask []unitType) {
-	var max float64
-	for i := 0; i < len(x); i++ {
-		if mask[i] != softmaxUnit {
+// samplePoisson draws from a poisson distribution with Knuth's algorithm for small rates, and
+// transformed rejection with squeeze (Hörmann, 1993) for large rates.
+func samplePoisson(rate float64) float64 {
+	// A rate that is not a positive finite number has no meaningful sample.
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return 0
+	}
+	if rate < 10 {
+		l := math.Exp(-rate)
+		var k float64
+		for p := rand.Float64(); p > l; p *= rand.Float64() {
+			k++
+		}
+		return k
+	}
+	slam := math.Sqrt(rate)
+	loglam := math.Log(rate)
+	b := 0.931 + 2.53*slam
+	a := -0.059 + 0.02483*b
+	invalpha := 1.1239 + 1.1328/(b-3.4)
+	vr := 0.9277 - 3.6224/(b-2)
+	for {
+		u := rand.Float64() - 0.5
+		v := rand.Float64()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + rate + 0.43)
+		if us >= 0.07 && v <= vr {
+			return k
+		}
+		if k < 0 || (us < 0.013 && v > us) {
 			continue
 		}
+		lg, _ := math.Lgamma(k + 1)
+		if math.Log(v)+math.Log(invalpha)-math.Log(a/(us*us)+b) <= -rate+k*loglam-lg {
+			return k
+		}
+	}
+}
+
+func sampleBinomial(trials int, p float64) float64 {
+	var k float64
+	for i := 0; i < trials; i++ {
+		k += sample(p)
+	}
+	return k
+}
+
+func softmax(x []float64, group []int) {
+	max := x[group[0]]
+	for _, i := range group {
 		if x[i] > max {
 			max = x[i]
 		}
 	}
 	var sum float64
-	for i := 0; i < len(x); i++ {
-		if mask[i] != softmaxUnit {
-			continue
-		}
+	for _, i := range group {
 		x[i] = math.Exp(x[i] - max)
 		sum += x[i]
 	}
-	for i := 0; i < len(x); i++ {
-		if mask[i] != softmaxUnit {
-			continue
-		}
+	for _, i := range group {
 		x[i] /= sum
 	}
 }
 
+// sampleSoftmax turns probabilities of a softmax group into a one-hot sample.
+func sampleSoftmax(x []float64, group []int) {
+	r := rand.Float64()
+	n := group[len(group)-1]
+	for _, i := range group {
+		r -= x[i]
+		if r < 0 {
+			n = i
+			break
+		}
+	}
+	for _, i := range group {
+		x[i] = 0
+	}
+	x[n] = 1
+}
+
 // visible unit activation energy
 func (m *rbm) ev(v int, h []float64) float64 {
-	e := m.bv[v]
+	e := m.bv[v] + m.ov[v]
 	for i := 0; i < m.Hidden(); i++ {
 		e += m.w[v][i] * h[i]
 	}
@@ -241,23 +577,180 @@ func (m *rbm) ev(v int, h []float64) float64 {
 
 // hidden unit activation energy
 func (m *rbm) eh(h int, v []float64) float64 {
-	e := m.bh[h]
+	e := m.bh[h] + m.oh[h]
 	for i := 0; i < m.Visible(); i++ {
-		e += m.w[i][h] * v[i]
+		// Gaussian visible units with variance σ² contribute v/σ² (Cho et al., 2011).
+		e += m.w[i][h] * v[i] * m.iv[i]
 	}
 	return e
 }
 
+// expected value of hidden unit with activation energy e
+func (m *rbm) meanHidden(h int, e float64) float64 {
+	switch m.ht[h] {
+	case GaussianUnit:
+		return e
+	case ReLUUnit:
+		return math.Max(0, e)
+	case ExponentialUnit:
+		if math.Abs(e) < 1e-6 {
+			return 0.5 + e/12
+		}
+		return 1/(1-math.Exp(-e)) - 1/e
+	}
+	return sigmoid(e)
+}
+
+// derivative of the expected value of a truncated exponential unit with respect to its activation energy e,
+// which is also its variance
+func exponentialVariance(e float64) float64 {
+	if math.Abs(e) < 1e-3 {
+		return 1.0/12 - e*e/240
+	}
+	s := math.Sinh(e / 2)
+	return 1/(e*e) - 1/(4*s*s)
+}
+
+func (m *rbm) sampleHidden(h int, e float64) float64 {
+	switch m.ht[h] {
+	case GaussianUnit:
+		return rand.NormFloat64() + e
+	case ReLUUnit:
+		// A rectified linear unit behaves like an infinite set of binary units with shared weights and
+		// offset biases -0.5, -1.5, -2.5, ... Their sum can be approximated by max(0, x + N(0, sigmoid(x))).
+		return math.Max(0, e+math.Sqrt(sigmoid(e))*rand.NormFloat64())
+	case ExponentialUnit:
+		// inverse of the cumulative distribution function exp(e * h) on [0, 1]
+		u := rand.Float64()
+		if math.Abs(e) < 1e-6 {
+			return u
+		}
+		if e > 0 {
+			return 1 + math.Log(u+(1-u)*math.Exp(-e))/e
+		}
+		return math.Log1p(u*math.Expm1(e)) / e
+	}
+	return sample(sigmoid(e))
+}
+
+// contribution of hidden unit with activation energy e to the free energy
+func (m *rbm) freeEnergyHidden(h int, e float64) float64 {
+	switch m.ht[h] {
+	case GaussianUnit:
+		return -e * e / 2
+	case ReLUUnit:
+		if math.IsNaN(e) || math.IsInf(e, 1) {
+			return -e
+		}
+		// Sum over the replicated binary units; terms beyond are too small to matter. The first n terms are
+		// e - offset, because softplus(x) ≈ x for x > 30, so they are added in closed form.
+		var f float64
+		offset := 0.5
+		if n := math.Ceil(e - 30 - offset); n > 0 {
+			f -= n*e - n*n/2
+			offset += n
+		}
+		for ; e-offset > -30; offset++ {
+			f -= softplus(e - offset)
+		}
+		return f
+	case ExponentialUnit:
+		// -log ∫ exp(e * h) dh over [0, 1]
+		if math.Abs(e) < 1e-6 {
+			return -e / 2
+		}
+		if e > 0 {
+			return -e - math.Log(-math.Expm1(-e)) + math.Log(e)
+		}
+		return -math.Log(-math.Expm1(e)) + math.Log(-e)
+	}
+	return -softplus(e)
+}
+
 func (m *rbm) ph(v []float64) []float64 {
 	for i := 0; i < m.Hidden(); i++ {
-		m.h[i] = sigmoid(m.eh(i, v))
+		m.h[i] = m.meanHidden(i, m.eh(i, v))
 	}
 	return m.h
 }
 
+// pv returns expected values of visible units given hidden units. Constrained poisson units keep the
+// total count of the current visible units.
+func (m *rbm) pv(h []float64) []float64 {
+	var count float64
+	for _, i := range m.pg {
+		count += m.v[i]
+	}
+	for i := 0; i < m.Visible(); i++ {
+		e := m.ev(i, h)
+		switch m.vt[i] {
+		case BinaryUnit:
+			m.v[i] = sigmoid(e)
+		case GaussianUnit, SoftmaxUnit, ConstrainedPoissonUnit:
+			m.v[i] = e
+		case PoissonUnit:
+			m.v[i] = math.Exp(math.Min(e, maxPoissonEnergy))
+		case BinomialUnit:
+			m.v[i] = float64(m.bn[i]) * sigmoid(e)
+		}
+	}
+	for _, group := range m.sg {
+		softmax(m.v, group)
+	}
+	if len(m.pg) > 0 {
+		softmax(m.v, m.pg)
+		for _, i := range m.pg {
+			m.v[i] *= count
+		}
+	}
+	return m.v
+}
+
+// resample samples visible units given hidden units into v, where count is the total count of constrained
+// poisson units. The activation energy is multiplied by beta, the inverse temperature, so gaussian units are
+// sampled with variance divided by beta instead, and poisson units with rate exp(beta*e).
+func (m *rbm) resample(count, beta float64) {
+	for i := 0; i < m.Visible(); i++ {
+		e := m.ev(i, m.h)
+		if m.vt[i] != GaussianUnit {
+			e *= beta
+		}
+		switch m.vt[i] {
+		case BinaryUnit:
+			// Assuming that the visible units are binary, the correct way to update the visible states when generating
+			// a reconstruction is to stochastically pick a 1 or 0 with a probability determined by the total top-down
+			// input.
+			m.v[i] = sample(sigmoid(e))
+		case GaussianUnit:
+			m.v[i] = rand.NormFloat64()/math.Sqrt(beta*m.iv[i]) + e
+		case SoftmaxUnit, ConstrainedPoissonUnit:
+			m.v[i] = e
+		case PoissonUnit:
+			m.v[i] = samplePoisson(math.Exp(math.Min(e, maxPoissonEnergy)))
+		case BinomialUnit:
+			// A binomial unit is the sum of binary units with shared weights and bias.
+			m.v[i] = sampleBinomial(m.bn[i], sigmoid(e))
+		}
+	}
+	for _, group := range m.sg {
+		softmax(m.v, group)
+		sampleSoftmax(m.v, group)
+	}
+	if len(m.pg) > 0 {
+		softmax(m.v, m.pg)
+		for _, i := range m.pg {
+			m.v[i] = samplePoisson(count * m.v[i])
+		}
+	}
+}
+
 // Reconstruct returns reconstructed visible units and hidden units with gibbs sampling
 func (m *rbm) Reconstruct(v []float64, step int) ([]float64, []float64) {
 	copy(m.v, v)
+	var count float64
+	for _, i := range m.pg {
+		count += v[i]
+	}
 	for s := 0; s < step; s++ {
 		for i := 0; i < m.Hidden(); i++ {
 			// It is very important to make these hidden states binary, rather than using the probabilities
@@ -265,64 +758,125 @@ func (m *rbm) Reconstruct(v []float64, step int) ([]float64, []float64) {
 			// visible units during the reconstruction. This seriously violates the information bottleneck created by
 			// the fact that a hidden unit can convey at most one bit (on average). This information bottleneck
 			// acts as a strong regularizer.
-			m.h[i] = sample(sigmoid(m.eh(i, m.v)))
-		}
-		for i := 0; i < m.Visible(); i++ {
-			e := m.ev(i, m.h)
-			switch m.vt[i] {
-			case binaryUnit:
-				// Assuming that the visible units are binary, the correct way to update the visible states when generating
-				// a reconstruction is to stochastically pick a 1 or 0 with a probability determined by the total top-down
-				// input.
-				m.v[i] = sample(sigmoid(e))
-			case gaussianUnit:
-				m.v[i] = rand.NormFloat64() + e
-			case softmaxUnit:
-				m.v[i] = e
-			}
-		}
-		// softmax
-		softmax(m.v, m.vt)
-		for i := 0; i < m.Visible(); i++ {
-			switch m.vt[i] {
-			case softmaxUnit:
-				m.v[i] = sample(m.v[i])
-			}
+			m.h[i] = m.sampleHidden(i, m.eh(i, m.v))
 		}
+		m.resample(count, 1)
+	}
+	return m.v, m.h
+}
+
+// ReconstructMean returns reconstructed visible units and hidden units with mean-field updates, where expected
+// values are used instead of samples, so the reconstruction is deterministic.
+func (m *rbm) ReconstructMean(v []float64, step int) ([]float64, []float64) {
+	// Constrained poisson units keep the total count of v.
+	copy(m.v, v)
+	for s := 0; s < step; s++ {
+		m.pv(m.ph(m.v))
 	}
 	return m.v, m.h
 }
 
-func (m *rbm) updateDelta(v, rv, h, rh []float64) {
+// Transform returns hidden probabilities of v, which can be used as deterministic features.
+func (m *rbm) Transform(v []float64) []float64 {
+	return m.ph(v)
+}
+
+// TransformAll returns hidden probabilities of each example in data.
+func (m *rbm) TransformAll(data [][]float64) [][]float64 {
+	out := make([][]float64, len(data))
+	for i, v := range data {
+		out[i] = make([]float64, m.Hidden())
+		copy(out[i], m.ph(v))
+	}
+	return out
+}
+
+// countScale returns the inverse of the mean count of poisson units in v if it is larger than 1, and 1 otherwise.
+// The gradient of poisson units grows with their counts, so it is scaled down to keep learning stable for large
+// counts.
+func (m *rbm) countScale(v []float64) float64 {
+	var n, sum float64
+	for i := 0; i < m.Visible(); i++ {
+		if m.vt[i] == PoissonUnit || m.vt[i] == ConstrainedPoissonUnit {
+			n++
+			sum += v[i]
+		}
+	}
+	if sum <= n {
+		return 1
+	}
+	return n / sum
+}
+
+func (m *rbm) updateDelta(v, rv, h, rh []float64, weight float64) {
+	scale := m.countScale(v)
 	// w
 	for i := 0; i < m.Visible(); i++ {
+		if m.missing != nil && m.missing[i] {
+			continue
+		}
+		s := m.iv[i]
+		if m.vt[i] == PoissonUnit || m.vt[i] == ConstrainedPoissonUnit {
+			s *= scale
+		}
 		for j := 0; j < m.Hidden(); j++ {
-			m.dw[i][j] += h[j]*v[i] - rh[j]*rv[i]
+			m.dw[i][j] += weight * (h[j]*v[i] - rh[j]*rv[i]) * s
 		}
 	}
 	// bv
 	for i := 0; i < m.Visible(); i++ {
-		m.dbv[i] += v[i] - rv[i]
+		if m.missing != nil && m.missing[i] {
+			continue
+		}
+		s := m.iv[i]
+		if m.vt[i] == PoissonUnit || m.vt[i] == ConstrainedPoissonUnit {
+			s *= scale
+		}
+		m.dbv[i] += weight * (v[i] - rv[i]) * s
+	}
+	// z
+	if m.learnVariance {
+		for i := 0; i < m.Visible(); i++ {
+			if m.vt[i] != GaussianUnit || m.missing != nil && m.missing[i] {
+				continue
+			}
+			// The derivative of the negative energy with respect to the log variance z is
+			// exp(-z) * ((v - bv)² / 2 - v * Σ w * h).
+			var pos, neg float64
+			for j := 0; j < m.Hidden(); j++ {
+				pos += m.w[i][j] * h[j]
+				neg += m.w[i][j] * rh[j]
+			}
+			b := m.bv[i] + m.ov[i]
+			pos = (v[i]-b)*(v[i]-b)/2 - v[i]*pos
+			neg = (rv[i]-b)*(rv[i]-b)/2 - rv[i]*neg
+			m.dz[i] += weight * (pos - neg) * m.iv[i]
+		}
 	}
 	// bh
 	for i := 0; i < m.Hidden(); i++ {
-		m.dbh[i] += h[i] - rh[i]
+		m.dbh[i] += weight * (h[i] - rh[i])
 	}
 }
 
 // contrastive divergence for weight updates
 func (m *rbm) cd(step int, v []float64) {
+	m.weightedCD(step, v, 1)
+}
+
+// weightedCD is contrastive divergence with its delta scaled by weight.
+func (m *rbm) weightedCD(step int, v []float64, weight float64) {
 	rv, _ := m.Reconstruct(v, step)
 	for i := 0; i < m.Hidden(); i++ {
 		// pj is a probability and hj is a binary state that takes value 1 with probability pj.
 		// Using hj is closer to the mathematical model of an rbm, but using pj usually has less sampling noise which
 		// allows slightly faster learning.
-		m.h[i] = sigmoid(m.eh(i, v))
+		m.h[i] = m.meanHidden(i, m.eh(i, v))
 		// For the last update of the hidden units, it is silly to use stochastic binary states because nothing
 		// depends on which state is chosen. So use the probability itself to avoid unnecessary sampling noise.
-		m.rh[i] = sigmoid(m.eh(i, rv))
+		m.rh[i] = m.meanHidden(i, m.eh(i, rv))
 	}
-	m.updateDelta(v, rv, m.h, m.rh)
+	m.updateDelta(v, rv, m.h, m.rh, weight)
 	return
 }
 
@@ -343,6 +897,23 @@ type Option struct {
 }
 
 func (m *rbm) update(rate float64) {
+	m.updateWeights(rate)
+	// bv
+	for i := 0; i < m.Visible(); i++ {
+		m.bv[i] += rate * (m.dbv[i] - weightDecay*m.bv[i])
+	}
+	// z
+	if m.learnVariance {
+		for i := 0; i < m.Visible(); i++ {
+			m.z[i] += rate * m.dz[i]
+		}
+		m.updateVariance()
+	}
+}
+
+// updateWeights is update of weights and hidden biases only, for gradients like backpropagation that do not
+// involve visible biases, which weight decay alone would otherwise change.
+func (m *rbm) updateWeights(rate float64) {
 	// w
 	for i := 0; i < m.Visible(); i++ {
 		for j := 0; j < m.Hidden(); j++ {
@@ -352,10 +923,6 @@ func (m *rbm) update(rate float64) {
 			m.w[i][j] += rate * (m.dw[i][j] - weightDecay*m.w[i][j])
 		}
 	}
-	// bv
-	for i := 0; i < m.Visible(); i++ {
-		m.bv[i] += rate * (m.dbv[i] - weightDecay*m.bv[i])
-	}
 	// bh
 	for i := 0; i < m.Hidden(); i++ {
 		m.bh[i] += rate * (m.dbh[i] - weightDecay*m.bh[i])
@@ -363,15 +930,105 @@ func (m *rbm) update(rate float64) {
 }
 
 func (m *rbm) Train(data [][]float64, opt *Option) {
+	train(m, len(data), opt, func(i int) {
+		m.cd(opt.GibbsStep, data[i])
+	})
+}
+
+// Impute returns v where missing units are replaced with their expected values given hidden units, which
+// are inferred from the other units only.
+func (m *rbm) Impute(v []float64, missing []bool) []float64 {
+	for j := 0; j < m.Hidden(); j++ {
+		e := m.bh[j] + m.oh[j]
+		for i := 0; i < m.Visible(); i++ {
+			if missing[i] {
+				continue
+			}
+			e += m.w[i][j] * v[i] * m.iv[i]
+		}
+		m.h[j] = m.meanHidden(j, e)
+	}
+	// Constrained poisson units keep the total count of v.
+	copy(m.v, v)
+	rv := m.pv(m.h)
+	for i := 0; i < m.Visible(); i++ {
+		if missing[i] {
+			m.mv[i] = rv[i]
+		} else {
+			m.mv[i] = v[i]
+		}
+	}
+	return m.mv
+}
+
+// Inpaint returns v where missing units are completed with gibbs sampling, while the other units are clamped to
+// their values in v. The chain starts from Impute, and after burnIn steps, missing units are averaged over the
+// samples of the next average steps. If average is 0, the last sample is returned. A softmax group should be
+// either all missing or all clamped.
+func (m *rbm) Inpaint(v []float64, missing []bool, burnIn, average int) []float64 {
+	copy(m.v, m.Impute(v, missing))
+	var count float64
+	for _, i := range m.pg {
+		count += m.v[i]
+	}
+	for i := range m.mv {
+		m.mv[i] = 0
+	}
+	for s := 0; s < burnIn+average; s++ {
+		for j := 0; j < m.Hidden(); j++ {
+			m.h[j] = m.sampleHidden(j, m.eh(j, m.v))
+		}
+		m.resample(count, 1)
+		for i := 0; i < m.Visible(); i++ {
+			if !missing[i] {
+				m.v[i] = v[i]
+			} else if s >= burnIn {
+				m.mv[i] += m.v[i] / float64(average)
+			}
+		}
+	}
+	for i := 0; i < m.Visible(); i++ {
+		if !missing[i] {
+			m.mv[i] = v[i]
+		} else if average == 0 {
+			m.mv[i] = m.v[i]
+		}
+	}
+	return m.mv
+}
+
+// TrainMissing is Train where missing[i][j] marks visible unit j of data[i] as missing, and missing or missing[i]
+// can be nil if all units are present. Missing units are imputed before contrastive divergence, sampled freely in
+// the negative phase, and do not contribute to the gradient of their weights and biases.
+func (m *rbm) TrainMissing(data [][]float64, missing [][]bool, opt *Option) {
+	train(m, len(data), opt, func(i int) {
+		if missing == nil || missing[i] == nil {
+			m.cd(opt.GibbsStep, data[i])
+			return
+		}
+		m.missing = missing[i]
+		m.cd(opt.GibbsStep, m.Impute(data[i], missing[i]))
+		m.missing = nil
+	})
+}
+
+// learner is a model that is trained with mini-batch gradient updates.
+type learner interface {
+	resetDelta()
+	update(rate float64)
+}
+
+// train runs mini-batch updates over n training cases, where learn accumulates the delta of case i.
+func train(m learner, n int, opt *Option, learn func(i int)) {
 	for r := 0; r < opt.Iteration; r++ {
-		for b := 0; b < len(data); b += opt.BatchSize {
+		for b := 0; b < n; b += opt.BatchSize {
 			size := opt.BatchSize
-			if size > len(data)-b {
-				size = len(data) - b
+			if size > n-b {
+				size = n - b
 			}
 			m.resetDelta()
 			for i := b; i < b+size; i++ {
-				m.cd(opt.GibbsStep, data[i])
+				learn(i)
 			}
 
 			// To avoid having to change the learning rate when the size of a mini-batch is changed, it is helpful
@@ -0,0 +1,422 @@
+package rbm
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHiddenMean(t *testing.T) {
+	m := New(1, 1)
+	total := 100000
+	for _, typ := range []UnitType{BinaryUnit, GaussianUnit, ReLUUnit, ExponentialUnit} {
+		err := m.SetHidden(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range []float64{-3, -0.5, 0, 0.5, 3} {
+			var sum float64
+			for i := 0; i < total; i++ {
+				sum += m.sampleHidden(0, e)
+			}
+			got := sum / float64(total)
+			want := m.meanHidden(0, e)
+			// NReLU is an approximation of the expected value.
+			if typ == ReLUUnit {
+				want = math.Max(0, e)
+				if math.Abs(got-want) > 0.5 {
+					t.Fatalf("type %d, energy %f: expect mean %f, got %f", typ, e, want, got)
+				}
+				continue
+			}
+			if math.Abs(got-want) > 0.02 {
+				t.Fatalf("type %d, energy %f: expect mean %f, got %f", typ, e, want, got)
+			}
+		}
+	}
+}
+
+func TestHiddenFreeEnergy(t *testing.T) {
+	m := New(1, 1)
+	for _, typ := range []UnitType{BinaryUnit, GaussianUnit, ExponentialUnit} {
+		err := m.SetHidden(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range []float64{-3, -0.5, 0.5, 3} {
+			// The derivative of the free energy with respect to e is the negative expected value.
+			delta := 1e-5
+			got := -(m.freeEnergyHidden(0, e+delta) - m.freeEnergyHidden(0, e-delta)) / (2 * delta)
+			want := m.meanHidden(0, e)
+			if math.Abs(got-want) > 1e-4 {
+				t.Fatalf("type %d, energy %f: expect %f, got %f", typ, e, want, got)
+			}
+		}
+	}
+
+	err := m.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []float64{-3, 0.5, 29.9, 30.6, 100.2} {
+		var want float64
+		for offset := 0.5; e-offset > -30; offset++ {
+			want -= softplus(e - offset)
+		}
+		got := m.freeEnergyHidden(0, e)
+		if math.Abs(got-want) > 1e-9*math.Abs(want) {
+			t.Fatalf("energy %f: expect %f, got %f", e, want, got)
+		}
+	}
+	// Large energy is summed in closed form, and non-finite energy is not summed at all.
+	if got := m.freeEnergyHidden(0, 1e7); math.Abs(got+1e7*1e7/2) > 1e-6*1e7*1e7 {
+		t.Fatalf("energy 1e7: expect %f, got %f", -1e7*1e7/2, got)
+	}
+	if got := m.freeEnergyHidden(0, math.Inf(1)); !math.IsInf(got, -1) {
+		t.Fatalf("energy +Inf: expect -Inf, got %f", got)
+	}
+	if got := m.freeEnergyHidden(0, math.NaN()); !math.IsNaN(got) {
+		t.Fatalf("energy NaN: expect NaN, got %f", got)
+	}
+}
+
+func TestSoftmaxGroupsTrain(t *testing.T) {
+	m := New(6, 8)
+	err := m.SetSoftmax(0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SetSoftmax(5, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := [][]float64{
+		{1, 0, 0, 0, 0, 1},
+		{0, 1, 0, 0, 1, 0},
+		{0, 0, 1, 1, 0, 0},
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 3000,
+		GibbsStep: 10,
+	})
+
+	total := 1000
+	for _, test := range data {
+		var count int
+		for i := 0; i < total; i++ {
+			got, _ := m.Reconstruct(test, 2)
+			for _, group := range [][]int{{0, 1, 2}, {3, 4, 5}} {
+				var on float64
+				for _, u := range group {
+					on += got[u]
+				}
+				if on != 1 {
+					t.Fatalf("expect one unit on in group %v, got %v", group, got)
+				}
+			}
+			if !reflect.DeepEqual(got, test) {
+				count++
+			}
+		}
+		errRate := float64(count) / float64(total)
+		if errRate > 0.05 {
+			t.Fatalf("reconstruct error rate %f", errRate)
+		}
+	}
+}
+
+func TestSetSoftmaxInvalid(t *testing.T) {
+	m := New(4, 2)
+	err := m.SetSoftmax(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, units := range [][]int{
+		{},
+		{1, 2},
+		{2, 2},
+		{3, 4},
+		{-1},
+	} {
+		err = m.SetSoftmax(units...)
+		if err != ErrInvalidGroup {
+			t.Fatalf("%v: expect %v, got %v", units, ErrInvalidGroup, err)
+		}
+	}
+
+	// Only binary units can form a softmax group.
+	for _, m := range []*rbm{
+		NewPoisson(4, 2).rbm,
+		NewConstrainedPoisson(4, 2).rbm,
+		NewBinomial(4, 2, 10).rbm,
+		NewGaussian(4, 2).rbm,
+	} {
+		err = m.SetSoftmax(0, 1)
+		if err != ErrInvalidGroup {
+			t.Fatalf("%v: expect %v, got %v", m.vt, ErrInvalidGroup, err)
+		}
+		if len(m.sg) != 0 {
+			t.Fatalf("expect no softmax group, got %v", m.sg)
+		}
+	}
+}
+
+func TestSoftmaxMarshal(t *testing.T) {
+	m := New(4, 2)
+	err := m.SetSoftmax(0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	m2 := New(4, 2)
+	err = m2.SetSoftmax(0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m2.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+
+	// Softmax groups must match.
+	for _, group := range [][]int{nil, {0, 1}, {1, 2, 3}} {
+		m3 := New(4, 2)
+		if group != nil {
+			err = m3.SetSoftmax(group...)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = m3.ReadFrom(bytes.NewReader(data))
+		if err != ErrInvalidArchitecture {
+			t.Fatalf("%v: expect %v, got %v", group, ErrInvalidArchitecture, err)
+		}
+	}
+}
+
+func TestTrainMissing(t *testing.T) {
+	m := New(6, 4)
+	patterns := [][]float64{
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 1},
+	}
+	var (
+		data    [][]float64
+		missing [][]bool
+	)
+	for i := 0; i < 200; i++ {
+		v := make([]float64, 6)
+		copy(v, patterns[i%2])
+		var mask []bool
+		if i%4 < 2 {
+			// A dropout is filled with 0, which should be ignored.
+			mask = make([]bool, 6)
+			for j := range mask {
+				if rand.Float64() < 0.3 {
+					mask[j] = true
+					v[j] = 0
+				}
+			}
+		}
+		data = append(data, v)
+		missing = append(missing, mask)
+	}
+	m.TrainMissing(data, missing, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	for _, p := range patterns {
+		mask := []bool{true, false, false, true, false, false}
+		v := make([]float64, 6)
+		copy(v, p)
+		v[0], v[3] = 0, 0
+		got := m.Impute(v, mask)
+		for i := range p {
+			if math.Abs(got[i]-p[i]) > 0.5 {
+				t.Fatalf("expect %v, got %v", p, got)
+			}
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			m.Impute(v, mask)
+		})
+		if allocs != 0 {
+			t.Fatalf("expect no allocation, got %f", allocs)
+		}
+	}
+}
+
+func TestTrainMissingNil(t *testing.T) {
+	// Without a mask, all units are present.
+	data := [][]float64{
+		{1, 1, 0},
+		{0, 0, 1},
+	}
+	for _, m := range []interface {
+		TrainMissing([][]float64, [][]bool, *Option)
+	}{New(3, 2), NewGaussianVariance(3, 2)} {
+		m.TrainMissing(data, nil, &Option{
+			BatchSize: 2,
+			Iteration: 1,
+			GibbsStep: 1,
+		})
+	}
+}
+
+func TestInpaint(t *testing.T) {
+	m := New(6, 4)
+	patterns := [][]float64{
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 1},
+	}
+	var data [][]float64
+	for i := 0; i < 200; i++ {
+		data = append(data, patterns[i%2])
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	mask := []bool{false, true, true, false, true, true}
+	for _, p := range patterns {
+		v := []float64{p[0], 0, 0, p[3], 0, 0}
+		got := m.Inpaint(v, mask, 10, 100)
+		for i := range p {
+			if math.Abs(got[i]-p[i]) > 0.5 {
+				t.Fatalf("expect %v, got %v", p, got)
+			}
+		}
+		got = m.Inpaint(v, mask, 10, 0)
+		if got[0] != p[0] || got[3] != p[3] {
+			t.Fatalf("expect clamped units %v, got %v", p, got)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			m.Inpaint(v, mask, 10, 10)
+		})
+		if allocs != 0 {
+			t.Fatalf("expect no allocation, got %f", allocs)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	m := New(6, 4)
+	patterns := [][]float64{
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 1},
+	}
+	var data [][]float64
+	for i := 0; i < 200; i++ {
+		data = append(data, patterns[i%2])
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	features := m.TransformAll(patterns)
+	for i, p := range patterns {
+		got := m.Transform(p)
+		if !reflect.DeepEqual(got, features[i]) {
+			t.Fatalf("expect %v, got %v", features[i], got)
+		}
+		for _, h := range got {
+			if h < 0 || h > 1 {
+				t.Fatalf("expect probabilities, got %v", got)
+			}
+		}
+	}
+	if reflect.DeepEqual(features[0], features[1]) {
+		t.Fatalf("expect different features, got %v", features)
+	}
+
+	for _, p := range patterns {
+		rv, _ := m.ReconstructMean(p, 5)
+		want := append([]float64(nil), rv...)
+		rv, _ = m.ReconstructMean(p, 5)
+		if !reflect.DeepEqual(rv, want) {
+			t.Fatalf("expect deterministic reconstruction %v, got %v", want, rv)
+		}
+		for i := range p {
+			if math.Abs(rv[i]-p[i]) > 0.5 {
+				t.Fatalf("expect %v, got %v", p, rv)
+			}
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Transform(patterns[0])
+		m.ReconstructMean(patterns[0], 5)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestHiddenTypeMarshal(t *testing.T) {
+	m := New(3, 2)
+	err := m.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	m2 := New(3, 2)
+	err = m2.SetHidden(ReLUUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The model is read one byte at a time, without unreading the byte after the header.
+	err = m2.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+
+	err = New(3, 2).ReadFrom(bytes.NewReader(data))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+
+	// A model written before the hidden type was recorded has no hidden type in its header.
+	old := bytes.Replace(data, []byte("3 2 3 false 0\n"), []byte("3 2\n"), 1)
+	for _, r := range []io.Reader{bytes.NewReader(old), iotest.OneByteReader(bytes.NewReader(old))} {
+		m3 := New(3, 2)
+		err = m3.SetHidden(ReLUUnit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m3.ReadFrom(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m3) {
+			t.Fatalf("not equal")
+		}
+	}
+}
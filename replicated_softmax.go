@@ -0,0 +1,184 @@
+package rbm
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Word is a word id in the dictionary and how many times it occurs in a document.
+type Word struct {
+	ID    int
+	Count float64
+}
+
+// ReplicatedSoftmax is a topic model for documents represented as bag of words
+// (Salakhutdinov & Hinton, 2009). Visible units are word counts of the dictionary, and a document
+// of D words is modeled as D softmax units with shared weights, so the hidden biases are scaled by D. The rbm is
+// not embedded, because its dense visible units are neither scaled by D nor normalized.
+type ReplicatedSoftmax struct {
+	rbm *rbm
+
+	cp []float64 // cumulative word probability
+}
+
+func NewReplicatedSoftmax(words, hidden int) *ReplicatedSoftmax {
+	return &ReplicatedSoftmax{
+		rbm: newRBM(words, hidden),
+		cp:  make([]float64, words),
+	}
+}
+
+func (m *ReplicatedSoftmax) Visible() int {
+	return m.rbm.Visible()
+}
+
+func (m *ReplicatedSoftmax) Hidden() int {
+	return m.rbm.Hidden()
+}
+
+func (m *ReplicatedSoftmax) Reset() {
+	m.rbm.Reset()
+}
+
+func (m *ReplicatedSoftmax) resetDelta() {
+	m.rbm.resetDelta()
+}
+
+func (m *ReplicatedSoftmax) update(rate float64) {
+	m.rbm.update(rate)
+}
+
+func (m *ReplicatedSoftmax) WriteTo(w io.Writer) (err error) {
+	return m.rbm.WriteTo(w)
+}
+
+func (m *ReplicatedSoftmax) ReadFrom(r io.Reader) (err error) {
+	return m.rbm.ReadFrom(r)
+}
+
+func length(doc []Word) float64 {
+	var d float64
+	for _, w := range doc {
+		d += w.Count
+	}
+	return d
+}
+
+// hidden unit activation energy of a document with d words
+func (m *ReplicatedSoftmax) eh(h int, doc []Word, d float64) float64 {
+	e := d * m.rbm.bh[h]
+	for _, w := range doc {
+		e += m.rbm.w[w.ID][h] * w.Count
+	}
+	return e
+}
+
+// hidden unit activation energy of dense word counts
+func (m *ReplicatedSoftmax) ehDense(h int, v []float64, d float64) float64 {
+	e := d * m.rbm.bh[h]
+	for i := 0; i < m.Visible(); i++ {
+		if v[i] == 0 {
+			continue
+		}
+		e += m.rbm.w[i][h] * v[i]
+	}
+	return e
+}
+
+// Transform returns hidden probabilities of a document, which can be used as its embedding.
+func (m *ReplicatedSoftmax) Transform(doc []Word) []float64 {
+	d := length(doc)
+	for i := 0; i < m.Hidden(); i++ {
+		m.rbm.h[i] = sigmoid(m.eh(i, doc, d))
+	}
+	return m.rbm.h
+}
+
+// TransformAll returns hidden probabilities of each document.
+func (m *ReplicatedSoftmax) TransformAll(docs [][]Word) [][]float64 {
+	out := make([][]float64, len(docs))
+	for i, doc := range docs {
+		out[i] = make([]float64, m.Hidden())
+		copy(out[i], m.Transform(doc))
+	}
+	return out
+}
+
+// sampleWords draws d words from the softmax over the dictionary given hidden units.
+func (m *ReplicatedSoftmax) sampleWords(d float64) {
+	max := math.Inf(-1)
+	for i := 0; i < m.Visible(); i++ {
+		m.cp[i] = m.rbm.ev(i, m.rbm.h)
+		if m.cp[i] > max {
+			max = m.cp[i]
+		}
+	}
+	var sum float64
+	for i := 0; i < m.Visible(); i++ {
+		sum += math.Exp(m.cp[i] - max)
+		m.cp[i] = sum
+		m.rbm.v[i] = 0
+	}
+	for n := int(math.Round(d)); n > 0; n-- {
+		i := sort.SearchFloat64s(m.cp, rand.Float64()*sum)
+		if i == m.Visible() {
+			i--
+		}
+		m.rbm.v[i]++
+	}
+}
+
+// Reconstruct returns reconstructed word counts and hidden units with gibbs sampling.
+// The reconstructed document has the same length.
+func (m *ReplicatedSoftmax) Reconstruct(doc []Word, step int) ([]float64, []float64) {
+	d := length(doc)
+	for s := 0; s < step; s++ {
+		for i := 0; i < m.Hidden(); i++ {
+			if s == 0 {
+				m.rbm.h[i] = sample(sigmoid(m.eh(i, doc, d)))
+			} else {
+				m.rbm.h[i] = sample(sigmoid(m.ehDense(i, m.rbm.v, d)))
+			}
+		}
+		m.sampleWords(d)
+	}
+	return m.rbm.v, m.rbm.h
+}
+
+// contrastive divergence for weight updates
+func (m *ReplicatedSoftmax) cd(step int, doc []Word) {
+	rv, _ := m.Reconstruct(doc, step)
+	d := length(doc)
+	for i := 0; i < m.Hidden(); i++ {
+		m.rbm.h[i] = sigmoid(m.eh(i, doc, d))
+		m.rbm.rh[i] = sigmoid(m.ehDense(i, rv, d))
+	}
+	// w and bv
+	for _, w := range doc {
+		for j := 0; j < m.Hidden(); j++ {
+			m.rbm.dw[w.ID][j] += m.rbm.h[j] * w.Count
+		}
+		m.rbm.dbv[w.ID] += w.Count
+	}
+	for i := 0; i < m.Visible(); i++ {
+		if rv[i] == 0 {
+			continue
+		}
+		for j := 0; j < m.Hidden(); j++ {
+			m.rbm.dw[i][j] -= m.rbm.rh[j] * rv[i]
+		}
+		m.rbm.dbv[i] -= rv[i]
+	}
+	// bh
+	for i := 0; i < m.Hidden(); i++ {
+		m.rbm.dbh[i] += d * (m.rbm.h[i] - m.rbm.rh[i])
+	}
+}
+
+func (m *ReplicatedSoftmax) Train(docs [][]Word, opt *Option) {
+	train(m, len(docs), opt, func(i int) {
+		m.cd(opt.GibbsStep, docs[i])
+	})
+}
@@ -0,0 +1,110 @@
+package rbm
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomDoc returns a document of n words drawn uniformly from words [from, to).
+func randomDoc(from, to, n int) []Word {
+	counts := make(map[int]float64)
+	for i := 0; i < n; i++ {
+		counts[from+rand.Intn(to-from)]++
+	}
+	var doc []Word
+	for id, count := range counts {
+		doc = append(doc, Word{ID: id, Count: count})
+	}
+	return doc
+}
+
+func TestReplicatedSoftmaxTrain(t *testing.T) {
+	m := NewReplicatedSoftmax(10, 4)
+	// 2 topics: words 0-4 and words 5-9
+	var docs [][]Word
+	for i := 0; i < 100; i++ {
+		docs = append(docs, randomDoc(5*(i%2), 5*(i%2)+5, 5+rand.Intn(20)))
+	}
+	m.Train(docs, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	})
+
+	total := 100
+	for topic := 0; topic < 2; topic++ {
+		var count, words float64
+		for i := 0; i < total; i++ {
+			doc := randomDoc(5*topic, 5*topic+5, 10)
+			got, _ := m.Reconstruct(doc, 2)
+			for id, c := range got {
+				if id/5 != topic {
+					count += c
+				}
+				words += c
+			}
+			if words != 10*float64(i+1) {
+				t.Fatalf("expect %d words, got %f", 10*(i+1), words)
+			}
+		}
+		errRate := count / words
+		if errRate > 0.05 {
+			t.Fatalf("topic %d: reconstruct error rate %f", topic, errRate)
+		}
+	}
+
+	// Documents of the same topic should have closer embeddings.
+	embed := func(doc []Word) []float64 {
+		return append([]float64(nil), m.Transform(doc)...)
+	}
+	dist := func(a, b []float64) float64 {
+		var d float64
+		for i := range a {
+			d += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return math.Sqrt(d)
+	}
+	a1 := embed(randomDoc(0, 5, 15))
+	a2 := embed(randomDoc(0, 5, 15))
+	b1 := embed(randomDoc(5, 10, 15))
+	if dist(a1, a2) >= dist(a1, b1) {
+		t.Fatalf("expect %v closer to %v than %v", a1, a2, b1)
+	}
+
+	all := m.TransformAll(docs[:2])
+	for i, doc := range docs[:2] {
+		if !reflect.DeepEqual(all[i], m.Transform(doc)) {
+			t.Fatalf("expect %v, got %v", m.Transform(doc), all[i])
+		}
+	}
+}
+
+func TestReplicatedSoftmaxMarshal(t *testing.T) {
+	m := NewReplicatedSoftmax(5, 2)
+	buf := new(bytes.Buffer)
+	err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewReplicatedSoftmax(5, 2)
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+}
+
+func TestReplicatedSoftmaxDenseMethods(t *testing.T) {
+	// Dense methods of rbm ignore the document length and the softmax, so they are not promoted.
+	var m interface{} = NewReplicatedSoftmax(10, 4)
+	if _, ok := m.(interface {
+		ReconstructMean([]float64, int) ([]float64, []float64)
+	}); ok {
+		t.Fatalf("expect no dense methods")
+	}
+}
@@ -0,0 +1,98 @@
+package rbm
+
+import (
+	"math"
+	"math/rand"
+)
+
+// SampleOption configures a Sampler.
+type SampleOption struct {
+	// Number of independent markov chains. Samples are drawn from each chain in turn.
+	Chains int
+	// Number of gibbs steps before the first sample of each chain, so that the chain forgets where it starts.
+	BurnIn int
+	// Number of gibbs steps between two samples of the same chain. Consecutive states of a chain are highly
+	// correlated.
+	Thinning int
+	// Temperature divides the activation energy of all units, where 0 is the same as 1. Higher temperature
+	// flattens the distribution so that chains mix faster. Poisson units are sampled with rate exp(e/Temperature),
+	// which tempers the energy but not the 1/n! base measure.
+	Temperature float64
+}
+
+// Sampler draws samples from the distribution of an rbm with persistent markov chains.
+type Sampler struct {
+	m     *rbm
+	opt   SampleOption
+	beta  float64     // inverse temperature
+	chain [][]float64 // visible state of each chain
+	count []float64   // total count of constrained poisson units of each chain
+	next  int         // chain of the next sample
+}
+
+// Sampler creates a sampler with the current weights. If data is empty, each chain starts from visible units
+// sampled with visible biases only; otherwise, chain c starts from data[c%len(data)]. Constrained poisson units
+// keep the total count of the start, so they need data to start from.
+func (m *rbm) Sampler(data [][]float64, opt *SampleOption) *Sampler {
+	s := &Sampler{
+		m:     m,
+		opt:   *opt,
+		beta:  1,
+		chain: make([][]float64, opt.Chains),
+		count: make([]float64, opt.Chains),
+	}
+	if opt.Temperature > 0 {
+		s.beta = 1 / opt.Temperature
+	}
+	for c := range s.chain {
+		s.chain[c] = make([]float64, m.Visible())
+		if len(data) > 0 {
+			copy(s.chain[c], data[c%len(data)])
+		} else {
+			for j := range m.h {
+				m.h[j] = 0
+			}
+			m.resample(0, s.beta)
+			copy(s.chain[c], m.v)
+		}
+		for _, i := range m.pg {
+			s.count[c] += s.chain[c][i]
+		}
+		s.step(c, opt.BurnIn)
+	}
+	return s
+}
+
+// step runs gibbs sampling on chain c for the given number of steps.
+func (s *Sampler) step(c, step int) {
+	m := s.m
+	copy(m.v, s.chain[c])
+	for k := 0; k < step; k++ {
+		for j := 0; j < m.Hidden(); j++ {
+			e := m.eh(j, m.v)
+			if m.ht[j] == GaussianUnit {
+				m.h[j] = e + rand.NormFloat64()/math.Sqrt(s.beta)
+			} else {
+				m.h[j] = m.sampleHidden(j, s.beta*e)
+			}
+		}
+		m.resample(s.count[c], s.beta)
+	}
+	copy(s.chain[c], m.v)
+}
+
+// Sample writes a sample of visible units into each slice of out, which must have Visible() units.
+func (s *Sampler) Sample(out [][]float64) {
+	if len(s.chain) == 0 {
+		return
+	}
+	thinning := s.opt.Thinning
+	if thinning < 1 {
+		thinning = 1
+	}
+	for _, v := range out {
+		s.step(s.next, thinning)
+		copy(v, s.chain[s.next])
+		s.next = (s.next + 1) % len(s.chain)
+	}
+}
@@ -0,0 +1,90 @@
+package rbm
+
+import (
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	m := New(6, 4)
+	patterns := [][]float64{
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 1},
+	}
+	var data [][]float64
+	for i := 0; i < 200; i++ {
+		data = append(data, patterns[i%2])
+	}
+	m.Train(data, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	for _, start := range [][][]float64{nil, {}, patterns} {
+		s := m.Sampler(start, &SampleOption{
+			Chains:   10,
+			BurnIn:   100,
+			Thinning: 5,
+		})
+		out := make([][]float64, 200)
+		for i := range out {
+			out[i] = make([]float64, 6)
+		}
+		s.Sample(out)
+		var count int
+		for _, v := range out {
+		match:
+			for _, p := range patterns {
+				for i := range p {
+					if v[i] != p[i] {
+						continue match
+					}
+				}
+				count++
+			}
+		}
+		if count < 150 {
+			t.Fatalf("expect samples of learned patterns, got %d of %d", count, len(out))
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			s.Sample(out[:10])
+		})
+		if allocs != 0 {
+			t.Fatalf("expect no allocation, got %f", allocs)
+		}
+	}
+}
+
+func TestSamplerTemperature(t *testing.T) {
+	m := New(6, 4)
+	for i := range m.bv {
+		m.bv[i] = 3
+	}
+	for _, c := range []struct {
+		temperature float64
+		min, max    float64
+	}{
+		{1, 0.9, 1},
+		{1000, 0.4, 0.6},
+	} {
+		s := m.Sampler(nil, &SampleOption{
+			Chains:      4,
+			BurnIn:      10,
+			Temperature: c.temperature,
+		})
+		out := make([][]float64, 500)
+		var mean float64
+		for i := range out {
+			out[i] = make([]float64, 6)
+		}
+		s.Sample(out)
+		for _, v := range out {
+			for _, x := range v {
+				mean += x / float64(len(out)*len(v))
+			}
+		}
+		if mean < c.min || mean > c.max {
+			t.Fatalf("temperature %f: expect mean in [%f, %f], got %f", c.temperature, c.min, c.max, mean)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+)
+
+// stack is an optional gaussian layer followed by binary layers, where hidden probabilities of
+// each layer are the input of the next.
+type stack struct {
+	gaussian *Gaussian
+	binary   []*Binary
+	layer    []*rbm // all layers from bottom to top
+}
+
+// newStack creates a layer between each pair of consecutive units.
+func newStack(withGaussian bool, units []int) stack {
+	var s stack
+	for i := 0; i < len(units)-1; i++ {
+		if withGaussian && i == 0 {
+			s.gaussian = NewGaussian(units[i], units[i+1])
+		} else {
+			s.binary = append(s.binary, New(units[i], units[i+1]))
+		}
+	}
+	if s.gaussian != nil {
+		s.layer = append(s.layer, s.gaussian.rbm)
+	}
+	for _, b := range s.binary {
+		s.layer = append(s.layer, b.rbm)
+	}
+	return s
+}
+
+// layers returns each layer from bottom to top.
+func (s *stack) layers() []*rbm {
+	return s.layer
+}
+
+// units returns the visible unit count of each layer.
+func (s *stack) units() []int {
+	var units []int
+	for _, l := range s.layers() {
+		units = append(units, l.Visible())
+	}
+	return units
+}
+
+// readArchitecture reads the header written by WriteTo of a stacked model with at least min unit counts.
+func readArchitecture(r io.Reader, min int) (withGaussian bool, units []int, err error) {
+	var n int
+	_, err = fmt.Fscan(r, &withGaussian, &n)
+	if err != nil {
+		return
+	}
+	if n < min {
+		err = ErrInvalidLayer
+		return
+	}
+	units = make([]int, n)
+	for i := 0; i < n; i++ {
+		_, err = fmt.Fscan(r, &units[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// sameArchitecture returns whether the architecture read by readArchitecture matches the stack, where
+// expected is the unit count of each layer of the model.
+func (s *stack) sameArchitecture(withGaussian bool, units, expected []int) bool {
+	if withGaussian != (s.gaussian != nil) || len(units) != len(expected) {
+		return false
+	}
+	for i := range units {
+		if units[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHeader writes the architecture that readArchitecture reads, where units is the unit count of each layer
+// of the model.
+func (s *stack) writeHeader(w io.Writer, units []int) (err error) {
+	_, err = fmt.Fprintf(w, "%t %d\n", s.gaussian != nil, len(units))
+	if err != nil {
+		return
+	}
+	return writeInts(w, units)
+}
+
+// pretrain trains each layer greedily from the bottom, and returns hidden probabilities of the top layer.
+func (s *stack) pretrain(input [][]float64, opt *Option) [][]float64 {
+	for _, l := range s.layers() {
+		l.Train(input, opt)
+
+		input2 := make([][]float64, len(input))
+		for i, v := range input {
+			rh := l.ph(v)
+			copied := make([]float64, len(rh))
+			copy(copied, rh)
+			input2[i] = copied
+		}
+		input = input2
+	}
+	return input
+}
+
+// features propagates input through the layers with hidden probabilities.
+func (s *stack) features(input []float64) []float64 {
+	if s.gaussian != nil {
+		input = s.gaussian.ph(input)
+	}
+	for _, b := range s.binary {
+		input = b.ph(input)
+	}
+	return input
+}
+
+func (s *stack) readLayers(r io.Reader) (err error) {
+	for _, l := range s.layers() {
+		err = l.ReadFrom(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *stack) writeLayers(w io.Writer) (err error) {
+	for _, l := range s.layers() {
+		err = l.WriteTo(w)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// derivative multiplies the gradient with respect to hidden units of layer l with input v, which is kept in rh,
+// by the derivative of hidden units with respect to their activation energy.
+func derivative(l *rbm, v []float64) {
+	for j := 0; j < l.Hidden(); j++ {
+		switch l.ht[j] {
+		case GaussianUnit:
+		case ReLUUnit:
+			if l.h[j] == 0 {
+				l.rh[j] = 0
+			}
+		case ExponentialUnit:
+			l.rh[j] *= exponentialVariance(l.eh(j, v))
+		default:
+			l.rh[j] *= l.h[j] * (1 - l.h[j])
+		}
+	}
+}
+
+// backward accumulates the gradient of weights and hidden biases of layer l with input v, where rh is
+// the gradient with respect to hidden activation energy. If g is not nil, the gradient with respect to v
+// is stored in g.
+func backward(l *rbm, v, g []float64) {
+	for j := 0; j < l.Hidden(); j++ {
+		l.dbh[j] += l.rh[j]
+	}
+	for i := 0; i < l.Visible(); i++ {
+		var d float64
+		for j := 0; j < l.Hidden(); j++ {
+			l.dw[i][j] += l.rh[j] * v[i] * l.iv[i]
+			d += l.rh[j] * l.w[i][j]
+		}
+		if g != nil {
+			g[i] = d * l.iv[i]
+		}
+	}
+}
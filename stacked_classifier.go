@@ -3,16 +3,17 @@ package rbm
 import (
 	"errors"
 	"io"
+	"strings"
 )
 
 type StackedClassifier struct {
-	gaussian   *Gaussian
-	binary     []*Binary
+	stack
 	classifier *Classifier
 }
 
 var (
-	ErrInvalidLayer = errors.New("not enough layer specified for stacked classifier")
+	ErrInvalidLayer        = errors.New("not enough layer specified for stacked classifier")
+	ErrInvalidArchitecture = errors.New("architecture does not match the model")
 )
 
 func NewStackedClassifier(withGaussian bool, units ...int) (*StackedClassifier, error) {
@@ -25,29 +26,59 @@ func NewStackedClassifier(withGaussian bool, units ...int) (*StackedClassifier,
 		return nil, ErrInvalidLayer
 	}
 	s.classifier = NewClassifier(units[len(units)-3], units[len(units)-2], units[len(units)-1])
-	for i := 0; i < len(units)-3; i++ {
-		if withGaussian && i == 0 {
-			s.gaussian = NewGaussian(units[i], units[i+1])
-		} else {
-			s.binary = append(s.binary, New(units[i], units[i+1]))
-		}
-	}
+	s.stack = newStack(withGaussian, units[:len(units)-2])
+
+	return s, nil
+}
+
+// units returns the unit count of each layer as passed to NewStackedClassifier.
+func (s *StackedClassifier) units() []int {
+	return append(s.stack.units(), s.classifier.Input(), s.classifier.Output(), s.classifier.Hidden())
+}
 
+// LoadStackedClassifier creates a stacked classifier from a model written by WriteTo
+// without knowing its architecture beforehand.
+func LoadStackedClassifier(r io.Reader) (*StackedClassifier, error) {
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewStackedClassifier(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	err = s.readLayers(r)
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
+// ReadFrom reads a model written by WriteTo. Models written before the architecture was recorded start with
+// the bottom layer, and are read without checking the architecture.
 func (s *StackedClassifier) ReadFrom(r io.Reader) (err error) {
-	if s.gaussian != nil {
-		err = s.gaussian.ReadFrom(r)
-		if err != nil {
-			return
-		}
+	line, err := readLine(r)
+	if err != nil {
+		return
 	}
-	for _, b := range s.binary {
-		err = b.ReadFrom(r)
-		if err != nil {
-			return
-		}
+	r = io.MultiReader(strings.NewReader(line+"\n"), r)
+	if f := strings.Fields(line)[0]; f != "true" && f != "false" {
+		return s.readLayers(r)
+	}
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return
+	}
+	if !s.sameArchitecture(withGaussian, units, s.units()) {
+		return ErrInvalidArchitecture
+	}
+	return s.readLayers(r)
+}
+
+func (s *StackedClassifier) readLayers(r io.Reader) (err error) {
+	err = s.stack.readLayers(r)
+	if err != nil {
+		return
 	}
 	err = s.classifier.ReadFrom(r)
 	if err != nil {
@@ -56,18 +87,19 @@ func (s *StackedClassifier) ReadFrom(r io.Reader) (err error) {
 	return
 }
 
+// line 1: whether the bottom layer is gaussian, and the number of layer units
+//
+// line 2: unit count of each layer separated by space
+//
+// line N: each layer from bottom to top
 func (s *StackedClassifier) WriteTo(w io.Writer) (err error) {
-	if s.gaussian != nil {
-		err = s.gaussian.WriteTo(w)
-		if err != nil {
-			return
-		}
+	err = s.writeHeader(w, s.units())
+	if err != nil {
+		return
 	}
-	for _, b := range s.binary {
-		err = b.WriteTo(w)
-		if err != nil {
-			return
-		}
+	err = s.writeLayers(w)
+	if err != nil {
+		return
 	}
 	err = s.classifier.WriteTo(w)
 	if err != nil {
@@ -76,40 +108,98 @@ func (s *StackedClassifier) WriteTo(w io.Writer) (err error) {
 	return
 }
 
+// Train pre-trains each layer greedily from the bottom. A negative label means the example is unlabeled;
+// it still trains the lower layers and the input part of the classifier.
 func (s *StackedClassifier) Train(input [][]float64, output []int, opt *Option) {
-	next := func(r *rbm) {
-		r.Train(input, opt)
-
-		input2 := make([][]float64, len(input))
-		for i, v := range input {
-			rh := r.ph(v)
-			copied := make([]float64, len(rh))
-			copy(copied, rh)
-			input2[i] = copied
-		}
-		input = input2
+	s.classifier.Train(s.pretrain(input, opt), output, opt)
+}
+
+func (s *StackedClassifier) Classify(input []float64) int {
+	return s.classifier.Classify(s.features(input))
+}
+
+// Probabilities returns p(y|x) over all labels.
+func (s *StackedClassifier) Probabilities(input []float64) []float64 {
+	return s.classifier.Probabilities(s.features(input))
+}
+
+// TopK returns at most k labels with the highest probability in descending order.
+func (s *StackedClassifier) TopK(input []float64, k int) []int {
+	return s.classifier.TopK(s.features(input), k)
+}
+
+// Generate returns expected input of label, where the input of the classifier is generated with the label
+// clamped, and then passed down through the visible probabilities of each lower layer. It returns nil if label is
+// out of range.
+func (s *StackedClassifier) Generate(label, step int) []float64 {
+	v := s.classifier.Generate(label, step)
+	if v == nil {
+		return nil
 	}
-	if s.gaussian != nil {
-		next(s.gaussian.rbm)
+	layers := s.layers()
+	for k := len(layers) - 1; k >= 0; k-- {
+		v = layers[k].pv(v)
 	}
-	for _, b := range s.binary {
-		next(b.rbm)
+	return v
+}
+
+func (s *StackedClassifier) resetDelta() {
+	for _, l := range s.layers() {
+		l.resetDelta()
 	}
-	s.classifier.Train(input, output, opt)
+	s.classifier.resetDelta()
 }
 
-func (s *StackedClassifier) Classify(input []float64) int {
-	next := func(r *rbm) {
-		rh := r.ph(input)
-		copied := make([]float64, len(rh))
-		copy(copied, rh)
-		input = copied
+// update applies the gradient of backpropagation, which does not involve the visible biases of lower layers
+// and the input biases of the classifier, so they are kept for generating input.
+func (s *StackedClassifier) update(rate float64) {
+	for _, l := range s.layers() {
+		l.updateWeights(rate)
 	}
-	if s.gaussian != nil {
-		next(s.gaussian.rbm)
+	c := s.classifier
+	c.updateWeights(rate)
+	for i := c.Input(); i < c.Visible(); i++ {
+		c.bv[i] += rate * (c.dbv[i] - weightDecay*c.bv[i])
+	}
+}
+
+// backprop accumulates the gradient of log p(n|x) of the unrolled network.
+func (s *StackedClassifier) backprop(input []float64, n int) {
+	layers := s.layers()
+	c := s.classifier
+	c.discriminative(s.features(input), n)
+	if len(layers) == 0 {
+		return
 	}
-	for _, b := range s.binary {
-		next(b.rbm)
+
+	// The output of each layer is in h, and the gradient with respect to it is kept in rh.
+	top := layers[len(layers)-1]
+	for i := 0; i < c.Input(); i++ {
+		var g float64
+		for j := 0; j < c.Hidden(); j++ {
+			g += c.h[j] * c.w[i][j]
+		}
+		top.rh[i] = g * c.iv[i]
 	}
-	return s.classifier.Classify(input)
+	for k := len(layers) - 1; k >= 0; k-- {
+		if k > 0 {
+			derivative(layers[k], layers[k-1].h)
+			backward(layers[k], layers[k-1].h, layers[k-1].rh)
+		} else {
+			derivative(layers[k], input)
+			backward(layers[k], input, nil)
+		}
+	}
+}
+
+// FineTune unrolls the pre-trained layers into a feed-forward network with sigmoid units, where the top
+// classifier gives p(y|x) as the softmax output, and trains all weights and hidden biases with backpropagation
+// to minimize cross-entropy. Examples with a negative label are skipped.
+func (s *StackedClassifier) FineTune(input [][]float64, output []int, opt *Option) {
+	train(s, len(input), opt, func(i int) {
+		if output[i] < 0 {
+			return
+		}
+		s.backprop(input[i], output[i])
+	})
 }
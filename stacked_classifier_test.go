@@ -818,3 +818,258 @@ func TestStackedClassifierTrain3(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadStackedClassifier(t *testing.T) {
+	for _, withGaussian := range []bool{true, false} {
+		m, err := NewStackedClassifier(withGaussian, 4, 8, 6, 2, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		err = m.WriteTo(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := LoadStackedClassifier(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Fatalf("not equal")
+		}
+	}
+}
+
+func TestStackedClassifierReadFromMismatch(t *testing.T) {
+	m, err := NewStackedClassifier(true, 4, 8, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := NewStackedClassifier(false, 4, 8, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m2.ReadFrom(buf)
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
+
+func TestStackedClassifierReadFromOldFormat(t *testing.T) {
+	m, err := NewStackedClassifier(true, 4, 8, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Older models have only the layers, and no hidden type.
+	buf := new(bytes.Buffer)
+	for _, l := range append(m.layers(), m.classifier.rbm) {
+		fmt.Fprintf(buf, "%d %d\n", l.Visible(), l.Hidden())
+		writeSlice(buf, l.bv)
+		writeSlice(buf, l.bh)
+		for i := range l.w {
+			writeSlice(buf, l.w[i])
+		}
+	}
+	m2, err := NewStackedClassifier(true, 4, 8, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("not equal")
+	}
+}
+
+func TestStackedClassifierProbabilities(t *testing.T) {
+	s, err := NewStackedClassifier(true, 4, 8, 6, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []float64{0.5, -1, 2, 0}
+	p := s.Probabilities(input)
+	var sum float64
+	for _, v := range p {
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("expect sum 1, got %f", sum)
+	}
+	top := s.TopK(input, 1)
+	if len(top) != 1 || top[0] != s.Classify(input) {
+		t.Fatalf("expect %d, got %v", s.Classify(input), top)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Probabilities(input)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestStackedClassifierFineTuneGradient(t *testing.T) {
+	for _, typ := range []UnitType{BinaryUnit, GaussianUnit, ReLUUnit, ExponentialUnit} {
+		testStackedClassifierFineTuneGradient(t, typ)
+	}
+}
+
+// testStackedClassifierFineTuneGradient checks backpropagation where the lower layers have hidden units of typ.
+func testStackedClassifierFineTuneGradient(t *testing.T, typ UnitType) {
+	s, err := NewStackedClassifier(true, 3, 4, 5, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range s.layers() {
+		err = l.SetHidden(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Larger weights make the hidden units nonlinear.
+		for i := 0; i < l.Visible(); i++ {
+			for j := 0; j < l.Hidden(); j++ {
+				l.w[i][j] = 0.5 * rand.NormFloat64()
+			}
+		}
+	}
+	input := []float64{0.5, -1, 2}
+	label := 1
+	logp := func() float64 {
+		return math.Log(s.Probabilities(input)[label])
+	}
+	s.resetDelta()
+	s.backprop(input, label)
+
+	delta := 1e-6
+	check := func(name string, x *float64, want float64) {
+		old := *x
+		*x = old + delta
+		f1 := logp()
+		*x = old - delta
+		f2 := logp()
+		*x = old
+		got := (f1 - f2) / (2 * delta)
+		if math.Abs(got-want) > 1e-5 {
+			t.Fatalf("type %d, %s: expect gradient %f, got %f", typ, name, want, got)
+		}
+	}
+	for _, l := range s.layers() {
+		for i := 0; i < l.Visible(); i++ {
+			for j := 0; j < l.Hidden(); j++ {
+				check("w", &l.w[i][j], l.dw[i][j])
+			}
+		}
+		for j := 0; j < l.Hidden(); j++ {
+			check("bh", &l.bh[j], l.dbh[j])
+		}
+	}
+	c := s.classifier
+	for i := 0; i < c.Visible(); i++ {
+		for j := 0; j < c.Hidden(); j++ {
+			check("classifier w", &c.w[i][j], c.dw[i][j])
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.backprop(input, label)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
+
+func TestStackedClassifierFineTune(t *testing.T) {
+	s, err := NewStackedClassifier(false, 8, 8, 8, 3, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prototype, input, output := prototypes(60, 0.1)
+	opt := &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	}
+	loss := func() float64 {
+		var sum float64
+		for i := range input {
+			sum -= math.Log(s.Probabilities(input[i])[output[i]])
+		}
+		return sum / float64(len(input))
+	}
+	s.Train(input, output, opt)
+	before := loss()
+	var bv [][]float64
+	for _, l := range s.layers() {
+		bv = append(bv, append([]float64(nil), l.bv...))
+	}
+	c := s.classifier
+	bv = append(bv, append([]float64(nil), c.bv[:c.Input()]...))
+	opt.Iteration = 1000
+	s.FineTune(input, output, opt)
+	after := loss()
+	// Backpropagation does not change visible biases, which are only used to generate input.
+	for k, l := range s.layers() {
+		if !reflect.DeepEqual(bv[k], l.bv) {
+			t.Fatalf("layer %d: expect visible bias %v, got %v", k, bv[k], l.bv)
+		}
+	}
+	if !reflect.DeepEqual(bv[len(bv)-1], c.bv[:c.Input()]) {
+		t.Fatalf("classifier: expect input bias %v, got %v", bv[len(bv)-1], c.bv[:c.Input()])
+	}
+	t.Logf("cross-entropy before %f, after %f", before, after)
+	if after >= before {
+		t.Fatalf("fine-tuning does not reduce cross-entropy")
+	}
+	for i := range prototype {
+		got := s.Classify(prototype[i])
+		if got != i {
+			t.Fatalf("%v: expect %v, got %v", prototype[i], i, got)
+		}
+	}
+}
+
+func TestStackedClassifierGenerate(t *testing.T) {
+	s, err := NewStackedClassifier(false, 8, 12, 12, 3, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prototype, input, output := prototypes(60, 0.05)
+	s.Train(input, output, &Option{
+		BatchSize: 10,
+		Iteration: 200,
+		GibbsStep: 1,
+	})
+
+	// The average generated input of each label should be closest to its prototype.
+	for label := range prototype {
+		mean := make([]float64, 8)
+		for n := 0; n < 100; n++ {
+			v := s.Generate(label, 20)
+			for i := range mean {
+				mean[i] += v[i] / 100
+			}
+		}
+		if k := closest(mean, prototype); k != label {
+			t.Fatalf("label %d: generated input %.2f is closest to prototype %d", label, mean, k)
+		}
+	}
+
+	for _, label := range []int{-1, 3} {
+		if v := s.Generate(label, 5); v != nil {
+			t.Fatalf("label %d: expect nil, got %v", label, v)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Generate(0, 5)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %f", allocs)
+	}
+}
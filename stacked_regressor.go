@@ -0,0 +1,219 @@
+package rbm
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// StackedRegressor predicts real-valued targets with a linear readout on top of a pre-trained feature stack.
+type StackedRegressor struct {
+	stack
+
+	w      [][]float64 // readout weight features * output
+	b      []float64   // readout bias
+	output []float64
+}
+
+// NewStackedRegressor creates a stacked regressor where the last unit count is the number of targets,
+// and the others are the layers of the feature stack as in NewStackedClassifier.
+func NewStackedRegressor(withGaussian bool, units ...int) (*StackedRegressor, error) {
+	// at least one layer and the readout
+	if len(units) < 3 {
+		return nil, ErrInvalidLayer
+	}
+	features, output := units[len(units)-2], units[len(units)-1]
+	s := &StackedRegressor{
+		stack:  newStack(withGaussian, units[:len(units)-1]),
+		w:      make([][]float64, features),
+		b:      make([]float64, output),
+		output: make([]float64, output),
+	}
+	for i := range s.w {
+		s.w[i] = make([]float64, output)
+	}
+	return s, nil
+}
+
+func (s *StackedRegressor) Output() int {
+	return len(s.b)
+}
+
+func (s *StackedRegressor) units() []int {
+	return append(s.stack.units(), len(s.w), s.Output())
+}
+
+// Train pre-trains the feature stack greedily from the bottom, and then fits the readout to output with
+// least squares in closed form.
+func (s *StackedRegressor) Train(input, output [][]float64, opt *Option) {
+	features := s.pretrain(input, opt)
+
+	// normal equations with a constant feature for bias
+	n := len(s.w) + 1
+	a := make([][]float64, n)
+	y := make([][]float64, n)
+	for i := 0; i < n; i++ {
+		a[i] = make([]float64, n)
+		y[i] = make([]float64, s.Output())
+	}
+	for k, f := range features {
+		for i := 0; i < n; i++ {
+			fi := 1.0
+			if i < len(f) {
+				fi = f[i]
+			}
+			for j := 0; j <= i; j++ {
+				fj := 1.0
+				if j < len(f) {
+					fj = f[j]
+				}
+				a[i][j] += fi * fj
+			}
+			for j := 0; j < s.Output(); j++ {
+				y[i][j] += fi * output[k][j]
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < i; j++ {
+			a[j][i] = a[i][j]
+		}
+	}
+	// Features of a pre-trained stack are often highly correlated, so a small ridge keeps the normal
+	// equations positive definite.
+	for i := 0; i < len(s.w); i++ {
+		a[i][i] += 1e-8 * float64(len(features))
+	}
+	solve(a, y)
+	for i := 0; i < len(s.w); i++ {
+		copy(s.w[i], y[i])
+	}
+	copy(s.b, y[len(s.w)])
+}
+
+// solve replaces b with the solution x of a x = b with cholesky decomposition, where a is symmetric
+// positive definite. a is overwritten.
+func solve(a, b [][]float64) {
+	n := len(a)
+	for j := 0; j < n; j++ {
+		for k := 0; k < j; k++ {
+			a[j][j] -= a[j][k] * a[j][k]
+		}
+		if a[j][j] < 1e-12 {
+			a[j][j] = 1e-12
+		}
+		a[j][j] = math.Sqrt(a[j][j])
+		for i := j + 1; i < n; i++ {
+			for k := 0; k < j; k++ {
+				a[i][j] -= a[i][k] * a[j][k]
+			}
+			a[i][j] /= a[j][j]
+		}
+	}
+	for c := range b[0] {
+		// forward substitution with l
+		for i := 0; i < n; i++ {
+			for k := 0; k < i; k++ {
+				b[i][c] -= a[i][k] * b[k][c]
+			}
+			b[i][c] /= a[i][i]
+		}
+		// backward substitution with transposed l
+		for i := n - 1; i >= 0; i-- {
+			for k := i + 1; k < n; k++ {
+				b[i][c] -= a[k][i] * b[k][c]
+			}
+			b[i][c] /= a[i][i]
+		}
+	}
+}
+
+// Predict returns the targets of input.
+func (s *StackedRegressor) Predict(input []float64) []float64 {
+	f := s.features(input)
+	copy(s.output, s.b)
+	for i, x := range f {
+		for j := range s.output {
+			s.output[j] += x * s.w[i][j]
+		}
+	}
+	return s.output
+}
+
+// LoadStackedRegressor creates a stacked regressor from a model written by WriteTo
+// without knowing its architecture beforehand.
+func LoadStackedRegressor(r io.Reader) (*StackedRegressor, error) {
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewStackedRegressor(withGaussian, units...)
+	if err != nil {
+		return nil, err
+	}
+	err = s.readLayers(r)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StackedRegressor) ReadFrom(r io.Reader) (err error) {
+	withGaussian, units, err := readArchitecture(r, 3)
+	if err != nil {
+		return
+	}
+	if !s.sameArchitecture(withGaussian, units, s.units()) {
+		return ErrInvalidArchitecture
+	}
+	return s.readLayers(r)
+}
+
+func (s *StackedRegressor) readLayers(r io.Reader) (err error) {
+	err = s.stack.readLayers(r)
+	if err != nil {
+		return
+	}
+	for i := range s.w {
+		for j := range s.w[i] {
+			_, err = fmt.Fscan(r, &s.w[i][j])
+			if err != nil {
+				return
+			}
+		}
+	}
+	for i := range s.b {
+		_, err = fmt.Fscan(r, &s.b[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// line 1: whether the bottom layer is gaussian, and the number of layer units
+//
+// line 2: unit count of each layer separated by space
+//
+// line N: each layer from bottom to top
+//
+// line N: readout weight separated by space
+//
+// line N: readout bias separated by space
+func (s *StackedRegressor) WriteTo(w io.Writer) (err error) {
+	err = s.writeHeader(w, s.units())
+	if err != nil {
+		return
+	}
+	err = s.writeLayers(w)
+	if err != nil {
+		return
+	}
+	for i := range s.w {
+		err = writeSlice(w, s.w[i])
+		if err != nil {
+			return
+		}
+	}
+	return writeSlice(w, s.b)
+}
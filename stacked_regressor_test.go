@@ -0,0 +1,127 @@
+package rbm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	a := [][]float64{
+		{4, 2, 0},
+		{2, 5, 1},
+		{0, 1, 3},
+	}
+	x := []float64{1, -2, 3}
+	b := make([][]float64, 3)
+	for i := range a {
+		b[i] = []float64{0}
+		for j := range a[i] {
+			b[i][0] += a[i][j] * x[j]
+		}
+	}
+	solve(a, b)
+	for i := range x {
+		if d := b[i][0] - x[i]; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("expect %v, got %v", x[i], b[i][0])
+		}
+	}
+}
+
+func TestStackedRegressorTrain(t *testing.T) {
+	s, err := NewStackedRegressor(false, 8, 16, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// number of bits that are on, and difference between the two halves
+	target := func(x []float64) []float64 {
+		var y [2]float64
+		for i, b := range x {
+			y[0] += b
+			if i < 4 {
+				y[1] += b
+			} else {
+				y[1] -= b
+			}
+		}
+		return y[:]
+	}
+	var input, output [][]float64
+	for i := 0; i < 256; i++ {
+		x := make([]float64, 8)
+		for j := range x {
+			x[j] = float64(i >> uint(j) & 1)
+		}
+		input = append(input, x)
+		output = append(output, target(x))
+	}
+	s.Train(input, output, &Option{
+		BatchSize: 10,
+		Iteration: 100,
+		GibbsStep: 1,
+	})
+
+	// mean squared error of the prediction compared to predicting the target mean
+	mean := []float64{4, 0}
+	var se, base [2]float64
+	for i, x := range input {
+		got := s.Predict(x)
+		for j := range got {
+			se[j] += (got[j] - output[i][j]) * (got[j] - output[i][j])
+			base[j] += (mean[j] - output[i][j]) * (mean[j] - output[i][j])
+		}
+	}
+	for j := range se {
+		t.Logf("target %d: mse %.3f, baseline %.3f", j, se[j]/256, base[j]/256)
+		if se[j] > 0.2*base[j] {
+			t.Fatalf("target %d is not learned", j)
+		}
+	}
+}
+
+func TestStackedRegressorMarshal(t *testing.T) {
+	s, err := NewStackedRegressor(true, 4, 3, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.w[1][0] = 1
+	s.b[1] = 2
+	buf := new(bytes.Buffer)
+	err = s.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := LoadStackedRegressor(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s2) {
+		t.Fatalf("not equal")
+	}
+	s3, err := NewStackedRegressor(true, 4, 3, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s3.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s3) {
+		t.Fatalf("not equal")
+	}
+	s4, err := NewStackedRegressor(true, 4, 3, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s4.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != ErrInvalidArchitecture {
+		t.Fatalf("expect %v, got %v", ErrInvalidArchitecture, err)
+	}
+}
+
+func TestStackedRegressorInvalid(t *testing.T) {
+	_, err := NewStackedRegressor(false, 3, 2)
+	if err != ErrInvalidLayer {
+		t.Fatalf("expect %v, got %v", ErrInvalidLayer, err)
+	}
+}